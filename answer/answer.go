@@ -0,0 +1,240 @@
+// Package answer decides whether a player's guess matches a question's
+// accepted answers, forgiving articles, punctuation, accents, spelled-out
+// numbers and small typos.
+package answer
+
+import (
+    "fmt"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "unicode"
+
+    "golang.org/x/text/runes"
+    "golang.org/x/text/transform"
+    "golang.org/x/text/unicode/norm"
+)
+
+// Step allows up to MaxDistance typos for answers of at least MinLength
+// characters (after normalization).
+type Step struct {
+    MinLength   int
+    MaxDistance int
+}
+
+// Tolerance is a set of steps; the step with the largest MinLength not
+// exceeding the answer's length applies.
+type Tolerance []Step
+
+// DefaultTolerance accepts one typo from 4 characters, two from 8 and three from 13.
+var DefaultTolerance = Tolerance{{4, 1}, {8, 2}, {13, 3}}
+
+// ParseTolerance reads a tolerance such as "4:1,8:2,13:3" (length:typos).
+// An empty string returns DefaultTolerance.
+func ParseTolerance(spec string) (Tolerance, error) {
+    spec = strings.TrimSpace(spec)
+    if spec == "" {
+        return DefaultTolerance, nil
+    }
+
+    var t Tolerance
+    for _, part := range strings.Split(spec, ",") {
+        length, distance, ok := strings.Cut(strings.TrimSpace(part), ":")
+        if !ok {
+            return nil, fmt.Errorf("invalid tolerance step %q, expected <length>:<typos>", part)
+        }
+        minLength, err := strconv.Atoi(length)
+        if err != nil || minLength < 0 {
+            return nil, fmt.Errorf("invalid tolerance length %q", length)
+        }
+        maxDistance, err := strconv.Atoi(distance)
+        if err != nil || maxDistance < 0 {
+            return nil, fmt.Errorf("invalid tolerance typos %q", distance)
+        }
+        t = append(t, Step{minLength, maxDistance})
+    }
+    sort.Slice(t, func(i, j int) bool { return t[i].MinLength < t[j].MinLength })
+    return t, nil
+}
+
+// String formats the tolerance the way ParseTolerance reads it, e.g. "4:1,8:2".
+func (t Tolerance) String() string {
+    var steps []string
+    for _, step := range t {
+        steps = append(steps, fmt.Sprintf("%d:%d", step.MinLength, step.MaxDistance))
+    }
+    return strings.Join(steps, ",")
+}
+
+// MaxDistance returns how many typos are allowed for an answer of the given length.
+func (t Tolerance) MaxDistance(length int) int {
+    distance := 0
+    for _, step := range t {
+        if length >= step.MinLength {
+            distance = step.MaxDistance
+        }
+    }
+    return distance
+}
+
+type Matcher struct {
+    Tolerance Tolerance
+}
+
+func NewMatcher(t Tolerance) *Matcher {
+    return &Matcher{Tolerance: t}
+}
+
+// Match reports whether guess matches any accepted answer. With exact set,
+// only a case-insensitive comparison is made, as for the original bot.
+func (m *Matcher) Match(guess string, accepted []string, exact bool) bool {
+    for _, want := range accepted {
+        if strings.EqualFold(strings.TrimSpace(guess), strings.TrimSpace(want)) {
+            return true
+        }
+        if exact {
+            continue
+        }
+
+        normalizedWant := Normalize(want)
+        if normalizedWant == "" {
+            continue // Nothing left to compare, e.g. an answer made of punctuation
+        }
+        normalizedGuess := Normalize(guess)
+        if normalizedGuess == normalizedWant {
+            return true
+        }
+
+        // Numbers must match exactly: 1984 is not a typo of 1985
+        if strings.IndexFunc(normalizedWant, unicode.IsDigit) >= 0 {
+            continue
+        }
+        if Distance(normalizedGuess, normalizedWant) <= m.Tolerance.MaxDistance(len([]rune(normalizedWant))) {
+            return true
+        }
+    }
+    return false
+}
+
+var (
+    stripMarks     = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+    digitGroups    = regexp.MustCompile(`(\d),(\d{3})`)
+    leadingArticle = map[string]bool{"the": true, "a": true, "an": true}
+)
+
+// Normalize lowercases s, removes accents, punctuation and a leading
+// article, and writes spelled-out numbers as digits.
+func Normalize(s string) string {
+    if stripped, _, err := transform.String(stripMarks, s); err == nil {
+        s = stripped
+    }
+    s = strings.ToLower(s)
+    for digitGroups.MatchString(s) { // Groups share digits, so "1,000,000" takes two passes
+        s = digitGroups.ReplaceAllString(s, "$1$2")
+    }
+    s = strings.NewReplacer("'", "", "’", "", "&", " and ").Replace(s)
+
+    s = strings.Map(func(r rune) rune {
+        if unicode.IsLetter(r) || unicode.IsDigit(r) {
+            return r
+        }
+        return ' '
+    }, s)
+
+    words := strings.Fields(s)
+    if len(words) > 1 && leadingArticle[words[0]] {
+        words = words[1:]
+    }
+    return strings.Join(canonicalNumbers(words), " ")
+}
+
+var (
+    numberUnits = map[string]int{
+        "zero": 0, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6,
+        "seven": 7, "eight": 8, "nine": 9, "ten": 10, "eleven": 11, "twelve": 12,
+        "thirteen": 13, "fourteen": 14, "fifteen": 15, "sixteen": 16,
+        "seventeen": 17, "eighteen": 18, "nineteen": 19, "twenty": 20,
+        "thirty": 30, "forty": 40, "fifty": 50, "sixty": 60, "seventy": 70,
+        "eighty": 80, "ninety": 90,
+    }
+    numberScales = map[string]int{"thousand": 1000, "million": 1000000}
+)
+
+// canonicalNumbers replaces number words ("twenty one", "one hundred and
+// five") with their digits. Only words that form one number are combined,
+// so "one two" stays two numbers.
+func canonicalNumbers(words []string) []string {
+    var out []string
+    total, current, inNumber := 0, 0, false
+    open := false // After "hundred" or a scale, where any number below 100 can follow
+
+    flush := func() {
+        if inNumber {
+            out = append(out, strconv.Itoa(total+current))
+        }
+        total, current, inNumber, open = 0, 0, false, false
+    }
+
+    for i, word := range words {
+        if value, ok := numberUnits[word]; ok {
+            tens := current%100 >= 20 && current%10 == 0
+            if inNumber && !open && !(tens && value >= 1 && value <= 9) {
+                flush()
+            }
+            current += value
+            inNumber, open = true, false
+            continue
+        }
+        if word == "hundred" && inNumber && current > 0 && current%100 == current {
+            current *= 100
+            open = true
+            continue
+        }
+        if scale, ok := numberScales[word]; ok && inNumber && current > 0 {
+            total += current * scale
+            current = 0
+            open = true
+            continue
+        }
+        // "and" only belongs to a number after "hundred" or a scale
+        if word == "and" && open && i+1 < len(words) {
+            if _, ok := numberUnits[words[i+1]]; ok {
+                continue
+            }
+        }
+        flush()
+        out = append(out, word)
+    }
+    flush()
+    return out
+}
+
+// Distance is the optimal string alignment distance between a and b: the
+// number of insertions, deletions, substitutions and adjacent swaps needed
+// to turn one into the other.
+func Distance(a, b string) int {
+    ra, rb := []rune(a), []rune(b)
+    rows := make([][]int, len(ra)+1)
+    for i := range rows {
+        rows[i] = make([]int, len(rb)+1)
+        rows[i][0] = i
+    }
+    for j := range rows[0] {
+        rows[0][j] = j
+    }
+
+    for i := 1; i <= len(ra); i++ {
+        for j := 1; j <= len(rb); j++ {
+            cost := 1
+            if ra[i-1] == rb[j-1] {
+                cost = 0
+            }
+            rows[i][j] = min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+            if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+                rows[i][j] = min(rows[i][j], rows[i-2][j-2]+1)
+            }
+        }
+    }
+    return rows[len(ra)][len(rb)]
+}
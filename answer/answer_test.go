@@ -0,0 +1,163 @@
+package answer
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestNormalize(t *testing.T) {
+    tests := []struct {
+        in, want string
+    }{
+        {"The Beatles", "beatles"},
+        {"A Tale of Two Cities", "tale of 2 cities"},
+        {"An", "an"}, // A lone article is the answer itself
+        {"Café Olé", "cafe ole"},
+        {"Tom & Jerry", "tom and jerry"},
+        {"Rock 'n' Roll!", "rock n roll"},
+        {"1,000,000", "1000000"},
+        {"twenty one", "21"},
+        {"one hundred and five", "105"},
+        {"one two", "1 2"},
+        {"two thousand and twenty", "2020"},
+        {"catch twenty two", "catch 22"},
+        {"one and two", "1 and 2"},
+        {"hundred years war", "hundred years war"},
+    }
+    for _, test := range tests {
+        if got := Normalize(test.in); got != test.want {
+            t.Errorf("Normalize(%q) = %q, want %q", test.in, got, test.want)
+        }
+    }
+}
+
+func TestCanonicalNumbers(t *testing.T) {
+    tests := []struct {
+        in, want []string
+    }{
+        {[]string{"twenty", "one"}, []string{"21"}},
+        {[]string{"twenty", "one", "two"}, []string{"21", "2"}},
+        {[]string{"twenty", "twenty"}, []string{"20", "20"}},
+        {[]string{"ten", "one"}, []string{"10", "1"}},
+        {[]string{"nineteen", "eighty", "four"}, []string{"19", "84"}},
+        {[]string{"one", "thousand", "two", "hundred", "thirty", "four"}, []string{"1234"}},
+        {[]string{"three", "million", "five", "hundred", "thousand"}, []string{"3500000"}},
+        {[]string{"route", "sixty", "six"}, []string{"route", "66"}},
+    }
+    for _, test := range tests {
+        if got := canonicalNumbers(test.in); !reflect.DeepEqual(got, test.want) {
+            t.Errorf("canonicalNumbers(%q) = %q, want %q", test.in, got, test.want)
+        }
+    }
+}
+
+func TestDistance(t *testing.T) {
+    tests := []struct {
+        a, b string
+        want int
+    }{
+        {"", "", 0},
+        {"", "abc", 3},
+        {"paris", "paris", 0},
+        {"paris", "pairs", 1}, // Adjacent swap
+        {"paris", "parish", 1},
+        {"kitten", "sitting", 3},
+        {"café", "cafe", 1},
+    }
+    for _, test := range tests {
+        if got := Distance(test.a, test.b); got != test.want {
+            t.Errorf("Distance(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+        }
+        if got := Distance(test.b, test.a); got != test.want {
+            t.Errorf("Distance(%q, %q) = %d, want %d", test.b, test.a, got, test.want)
+        }
+    }
+}
+
+func TestMaxDistance(t *testing.T) {
+    for length, want := range map[int]int{0: 0, 3: 0, 4: 1, 7: 1, 8: 2, 12: 2, 13: 3, 40: 3} {
+        if got := DefaultTolerance.MaxDistance(length); got != want {
+            t.Errorf("MaxDistance(%d) = %d, want %d", length, got, want)
+        }
+    }
+}
+
+func TestMatch(t *testing.T) {
+    m := NewMatcher(DefaultTolerance)
+    tests := []struct {
+        guess    string
+        accepted []string
+        exact    bool
+        want     bool
+    }{
+        {"the beatles", []string{"Beatles"}, false, true},
+        {"Cafe", []string{"Café"}, false, true},
+        {"twenty one", []string{"21"}, false, true},
+        {"one two", []string{"3"}, false, false},
+        {"1985", []string{"1984"}, false, false},                 // Numbers must match exactly
+        {"nineteen eighty four", []string{"1984"}, false, false}, // "19 84" is two numbers
+
+        // Tolerance boundaries: 3 characters allow no typos, 4 allow 1,
+        // 8 allow 2 and 13 allow 3
+        {"cot", []string{"cat"}, false, false},
+        {"bost", []string{"boat"}, false, true},
+        {"bxst", []string{"boat"}, false, false},
+        {"tonnessee", []string{"tennessee"}, false, true},
+        {"elefant", []string{"elephant"}, false, true},
+        {"elefamt", []string{"elephant"}, false, false},
+        {"mississippy", []string{"mississippi"}, false, true},
+        {"encyclopydai", []string{"encyclopedia"}, false, true},
+        {"oncyclopydai", []string{"encyclopedia"}, false, false},
+        {"chixkex", []string{"chicken"}, false, false},
+        {"xedxterranexn", []string{"mediterranean"}, false, true},
+        {"xedxterrxnexn", []string{"mediterranean"}, false, false},
+
+        // Exact answers only forgive case and surrounding spaces
+        {" PARIS ", []string{"Paris"}, true, true},
+        {"the paris", []string{"Paris"}, true, false},
+        {"pairs", []string{"Paris"}, true, false},
+        {"pairs", []string{"Paris"}, false, true},
+
+        {"gray", []string{"Grey", "Gray"}, true, true},
+        {"", []string{"?!"}, false, false},
+    }
+    for _, test := range tests {
+        if got := m.Match(test.guess, test.accepted, test.exact); got != test.want {
+            t.Errorf("Match(%q, %q, exact=%v) = %v, want %v", test.guess, test.accepted, test.exact, got, test.want)
+        }
+    }
+}
+
+func TestParseTolerance(t *testing.T) {
+    tests := []struct {
+        spec    string
+        want    Tolerance
+        wantErr bool
+    }{
+        {"", DefaultTolerance, false},
+        {"  ", DefaultTolerance, false},
+        {"8:2, 4:1", Tolerance{{4, 1}, {8, 2}}, false},
+        {"0:0", Tolerance{{0, 0}}, false},
+        {"4", nil, true},
+        {"4:1,", nil, true},
+        {"four:1", nil, true},
+        {"4:one", nil, true},
+        {"-1:1", nil, true},
+        {"4:-1", nil, true},
+    }
+    for _, test := range tests {
+        got, err := ParseTolerance(test.spec)
+        if test.wantErr {
+            if err == nil {
+                t.Errorf("ParseTolerance(%q) = %v, want an error", test.spec, got)
+            }
+            continue
+        }
+        if err != nil || !reflect.DeepEqual(got, test.want) {
+            t.Errorf("ParseTolerance(%q) = %v, %v, want %v", test.spec, got, err, test.want)
+        }
+    }
+    if got, _ := ParseTolerance(DefaultTolerance.String()); !reflect.DeepEqual(got, DefaultTolerance) {
+        t.Errorf("the default tolerance doesn't survive a round trip: %v", got)
+    }
+}
@@ -0,0 +1,264 @@
+// Package bank reads and writes the question bank as JSON or CSV files so
+// it can be exported, edited outside Discord and imported again.
+package bank
+
+import (
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io"
+    "path"
+    "strconv"
+    "strings"
+
+    "github.com/airylvat/trivia-bot/db"
+)
+
+// Supported file formats
+const (
+    FormatJSON = "json"
+    FormatCSV  = "csv"
+)
+
+// FormatFromName picks the format from a file name's extension.
+func FormatFromName(name string) (string, error) {
+    switch ext := strings.ToLower(strings.TrimPrefix(path.Ext(name), ".")); ext {
+    case FormatJSON, FormatCSV:
+        return ext, nil
+    default:
+        return "", fmt.Errorf("unsupported file type %q, expected .json or .csv", path.Ext(name))
+    }
+}
+
+// Record is one question as it appears in an export file or the HTTP API.
+type Record struct {
+    ID           int      `json:"id,omitempty"`
+    Text         string   `json:"text"`
+    Answer       string   `json:"answer"`
+    Kind         string   `json:"kind,omitempty"`
+    WrongAnswers []string `json:"wrong_answers,omitempty"`
+    Aliases      []string `json:"aliases,omitempty"`
+    Exact        bool     `json:"exact,omitempty"`
+    Category     string   `json:"category,omitempty"`
+    Tags         []string `json:"tags,omitempty"`
+    Difficulty   string   `json:"difficulty,omitempty"`
+}
+
+var csvHeader = []string{"id", "text", "answer", "kind", "wrong_answers", "aliases", "exact", "category", "tags", "difficulty"}
+
+// listSeparator joins list fields such as tags inside a single CSV cell.
+const listSeparator = ";"
+
+// ToRecord converts a question to its file form.
+func ToRecord(q db.Question) Record {
+    return Record{
+        ID:           q.ID,
+        Text:         q.Text,
+        Answer:       q.Answer,
+        Kind:         q.Kind,
+        WrongAnswers: q.Distractors,
+        Aliases:      q.Aliases,
+        Exact:        q.ExactOnly,
+        Category:     q.Category,
+        Tags:         q.Tags,
+        Difficulty:   db.DifficultyName(q.Difficulty),
+    }
+}
+
+// Export writes questions in the given format.
+func Export(w io.Writer, format string, questions []db.Question) error {
+    switch format {
+    case FormatJSON:
+        records := make([]Record, 0, len(questions))
+        for _, q := range questions {
+            records = append(records, ToRecord(q))
+        }
+        enc := json.NewEncoder(w)
+        enc.SetIndent("", "  ")
+        return enc.Encode(records)
+
+    case FormatCSV:
+        cw := csv.NewWriter(w)
+        if err := cw.Write(csvHeader); err != nil {
+            return err
+        }
+        for _, q := range questions {
+            r := ToRecord(q)
+            if err := cw.Write([]string{
+                strconv.Itoa(r.ID),
+                r.Text,
+                r.Answer,
+                r.Kind,
+                strings.Join(r.WrongAnswers, listSeparator),
+                strings.Join(r.Aliases, listSeparator),
+                strconv.FormatBool(r.Exact),
+                r.Category,
+                strings.Join(r.Tags, listSeparator),
+                r.Difficulty,
+            }); err != nil {
+                return err
+            }
+        }
+        cw.Flush()
+        return cw.Error()
+
+    default:
+        return fmt.Errorf("unsupported format %q", format)
+    }
+}
+
+// Row is one parsed import row. Err is set when the row is invalid, in which
+// case Question may be incomplete.
+type Row struct {
+    Line     int // Row number in the file, starting at 1 for the first question
+    Question *db.Question
+    Err      error
+}
+
+// Parse reads an import file and validates every row. It only fails as a
+// whole when the file itself can't be read; bad rows are reported in Row.Err.
+func Parse(r io.Reader, format string) ([]Row, error) {
+    var records []Record
+    var rowErrs []error
+
+    switch format {
+    case FormatJSON:
+        if err := json.NewDecoder(r).Decode(&records); err != nil {
+            return nil, fmt.Errorf("invalid JSON: %w", err)
+        }
+        rowErrs = make([]error, len(records))
+
+    case FormatCSV:
+        cr := csv.NewReader(r)
+        cr.FieldsPerRecord = -1
+        lines, err := cr.ReadAll()
+        if err != nil {
+            return nil, fmt.Errorf("invalid CSV: %w", err)
+        }
+        if len(lines) == 0 {
+            return nil, fmt.Errorf("the CSV file is empty")
+        }
+
+        columns := make(map[string]int)
+        for i, name := range lines[0] {
+            columns[strings.ToLower(strings.TrimSpace(name))] = i
+        }
+        if _, ok := columns["text"]; !ok {
+            return nil, fmt.Errorf("the CSV header must include at least text and answer columns")
+        }
+        if _, ok := columns["answer"]; !ok {
+            return nil, fmt.Errorf("the CSV header must include at least text and answer columns")
+        }
+
+        for _, line := range lines[1:] {
+            rec, err := csvRecord(line, columns)
+            records = append(records, rec)
+            rowErrs = append(rowErrs, err)
+        }
+
+    default:
+        return nil, fmt.Errorf("unsupported format %q", format)
+    }
+
+    rows := make([]Row, len(records))
+    seenIDs := make(map[int]int)
+    for i, rec := range records {
+        rows[i] = Row{Line: i + 1, Err: rowErrs[i]}
+        if rows[i].Err != nil {
+            continue
+        }
+        rows[i].Question, rows[i].Err = ToQuestion(rec)
+        if rows[i].Err == nil && rec.ID != 0 {
+            if first, dup := seenIDs[rec.ID]; dup {
+                rows[i].Err = fmt.Errorf("id %d is already used by row %d", rec.ID, first)
+            }
+            seenIDs[rec.ID] = i + 1
+        }
+    }
+    return rows, nil
+}
+
+func csvRecord(line []string, columns map[string]int) (Record, error) {
+    cell := func(name string) string {
+        if i, ok := columns[name]; ok && i < len(line) {
+            return strings.TrimSpace(line[i])
+        }
+        return ""
+    }
+    list := func(name string) []string {
+        var values []string
+        for _, value := range strings.Split(cell(name), listSeparator) {
+            if value = strings.TrimSpace(value); value != "" {
+                values = append(values, value)
+            }
+        }
+        return values
+    }
+
+    rec := Record{
+        Text:         cell("text"),
+        Answer:       cell("answer"),
+        Kind:         cell("kind"),
+        WrongAnswers: list("wrong_answers"),
+        Aliases:      list("aliases"),
+        Category:     cell("category"),
+        Tags:         list("tags"),
+        Difficulty:   cell("difficulty"),
+    }
+    if id := cell("id"); id != "" {
+        parsed, err := strconv.Atoi(id)
+        if err != nil || parsed < 0 {
+            return rec, fmt.Errorf("invalid id %q", id)
+        }
+        rec.ID = parsed
+    }
+    if exact := cell("exact"); exact != "" {
+        parsed, err := parseBool(exact)
+        if err != nil {
+            return rec, fmt.Errorf("invalid exact value %q", exact)
+        }
+        rec.Exact = parsed
+    }
+    return rec, nil
+}
+
+func parseBool(value string) (bool, error) {
+    switch strings.ToLower(value) {
+    case "yes", "y", "true", "1":
+        return true, nil
+    case "no", "n", "false", "0":
+        return false, nil
+    }
+    return false, fmt.Errorf("expected yes or no")
+}
+
+// ToQuestion converts a record to a question and validates it. The question
+// is returned even when invalid so the caller can describe it.
+func ToQuestion(rec Record) (*db.Question, error) {
+    q := &db.Question{
+        ID:          rec.ID,
+        Text:        strings.TrimSpace(rec.Text),
+        Answer:      strings.TrimSpace(rec.Answer),
+        Kind:        strings.ToLower(strings.TrimSpace(rec.Kind)),
+        Distractors: rec.WrongAnswers,
+        Aliases:     rec.Aliases,
+        ExactOnly:   rec.Exact,
+        Category:    strings.TrimSpace(rec.Category),
+        Tags:        rec.Tags,
+        Difficulty:  db.DifficultyMedium,
+    }
+    if q.Kind == "" {
+        q.Kind = db.KindText
+        if len(q.Distractors) > 0 {
+            q.Kind = db.KindChoice
+        }
+    }
+    if rec.Difficulty != "" {
+        difficulty, err := db.ParseDifficulty(rec.Difficulty)
+        if err != nil {
+            return q, err
+        }
+        q.Difficulty = difficulty
+    }
+    return q, q.Validate()
+}
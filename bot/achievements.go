@@ -0,0 +1,343 @@
+package bot
+
+import (
+    "database/sql"
+    "errors"
+    "fmt"
+    "log"
+    "regexp"
+    "strings"
+    "time"
+
+    "github.com/airylvat/trivia-bot/db"
+)
+
+// achievementProgress is what achievements are judged on: a player's
+// lifetime profile and, when a game ends, how they did in it.
+type achievementProgress struct {
+    profile *db.Profile
+    perfect int // Questions in the game that just ended, if the player answered all of them correctly
+}
+
+// achievementMetric is a stat achievements can be defined on. Achievements
+// themselves are rows in the database, so admins can add their own.
+type achievementMetric struct {
+    name        string
+    description string // What the threshold measures
+    met         func(p achievementProgress, threshold int) bool
+}
+
+var achievementMetrics = []*achievementMetric{
+    {
+        name:        "correct",
+        description: "lifetime correct answers",
+        met:         func(p achievementProgress, n int) bool { return p.profile.Correct >= n },
+    },
+    {
+        name:        "streak",
+        description: "correct answers in a row",
+        met:         func(p achievementProgress, n int) bool { return p.profile.LongestStreak >= n },
+    },
+    {
+        name:        "fastest",
+        description: "a correct answer in under this many seconds",
+        met: func(p achievementProgress, n int) bool {
+            return p.profile.Fastest > 0 && p.profile.Fastest < time.Duration(n)*time.Second
+        },
+    },
+    {
+        name:        "points",
+        description: "lifetime points",
+        met:         func(p achievementProgress, n int) bool { return p.profile.Points >= n },
+    },
+    {
+        name:        "games",
+        description: "games played",
+        met:         func(p achievementProgress, n int) bool { return p.profile.Games >= n },
+    },
+    {
+        name:        "wins",
+        description: "games won",
+        met:         func(p achievementProgress, n int) bool { return p.profile.Wins >= n },
+    },
+    {
+        name:        "perfect_game",
+        description: "every question answered correctly in a game of at least this many questions",
+        met:         func(p achievementProgress, n int) bool { return p.perfect >= n },
+    },
+}
+
+func findMetric(name string) *achievementMetric {
+    for _, metric := range achievementMetrics {
+        if metric.name == name {
+            return metric
+        }
+    }
+    return nil
+}
+
+func metricNames() []string {
+    var names []string
+    for _, metric := range achievementMetrics {
+        names = append(names, metric.name)
+    }
+    return names
+}
+
+// checkAchievements unlocks any achievements the player has earned and
+// announces them in the game's channel. Definitions and each player's
+// unlocked achievements are cached for the game, so the profile is only
+// loaded when there is something left the player could earn.
+func (b *Bot) checkAchievements(t *Trivia, userID string, perfect int) {
+    if t.achievements == nil {
+        achievements, err := b.DB.ListAchievements()
+        if err != nil {
+            log.Printf("Error loading achievements: %v", err)
+            return
+        }
+        t.achievements = append([]db.Achievement{}, achievements...)
+        t.unlocked = make(map[string]map[string]bool)
+    }
+    have, ok := t.unlocked[userID]
+    if !ok {
+        owned, err := b.DB.ListUserAchievements(t.GuildID, userID)
+        if err != nil {
+            log.Printf("Error loading achievements of %s: %v", userID, err)
+            return
+        }
+        have = make(map[string]bool)
+        for _, a := range owned {
+            have[a.Key] = true
+        }
+        t.unlocked[userID] = have
+    }
+
+    var pending []db.Achievement
+    for _, a := range t.achievements {
+        // Perfect games are only judged when a game ends
+        if have[a.Key] || findMetric(a.Metric) == nil || (a.Metric == "perfect_game" && perfect == 0) {
+            continue
+        }
+        pending = append(pending, a)
+    }
+    if len(pending) == 0 {
+        return
+    }
+
+    profile, err := b.DB.GetProfile(t.GuildID, userID)
+    if err != nil {
+        log.Printf("Error loading profile of %s for achievements: %v", userID, err)
+        return
+    }
+
+    progress := achievementProgress{profile: profile, perfect: perfect}
+    for _, a := range pending {
+        if !findMetric(a.Metric).met(progress, a.Threshold) {
+            continue
+        }
+        unlocked, err := b.DB.UnlockAchievement(t.GuildID, userID, a.Key, t.GameID)
+        if err != nil {
+            log.Printf("Error unlocking achievement %s for %s: %v", a.Key, userID, err)
+            continue
+        }
+        have[a.Key] = true
+        if unlocked {
+            b.Transport.ChannelMessageSend(t.ChannelID, fmt.Sprintf("<@%s> unlocked the **%s** achievement: %s!", userID, a.Name, a.Description))
+            log.Printf("User %s unlocked achievement %s in game %d", userID, a.Key, t.GameID)
+        }
+    }
+}
+
+// checkGameAchievements judges everyone who answered in a game once it has
+// ended, including whether they had a perfect game.
+func (b *Bot) checkGameAchievements(t *Trivia) {
+    attempts, err := b.DB.ListGameAttempts(t.GameID)
+    if err != nil {
+        log.Printf("Error loading answers of game %d for achievements: %v", t.GameID, err)
+        return
+    }
+
+    var players []string
+    correct := make(map[string]map[int]bool) // Questions each player answered correctly
+    for _, a := range attempts {
+        if _, seen := correct[a.UserID]; !seen {
+            players = append(players, a.UserID)
+            correct[a.UserID] = make(map[int]bool)
+        }
+        if a.Correct {
+            correct[a.UserID][a.QuestionID] = true
+        }
+    }
+
+    for _, userID := range players {
+        perfect := 0
+        if t.Asked > 0 && len(correct[userID]) >= t.Asked {
+            perfect = t.Asked
+        }
+        b.checkAchievements(t, userID, perfect)
+    }
+}
+
+// handleBadges lists the achievements a player has unlocked in this server.
+func (b *Bot) handleBadges(c *Context) {
+    userID, ok := userArg(c)
+    if !ok {
+        c.Reply(b.prefixed(c.GuildID, "Usage: `!!trivia badges [@user]`"))
+        return
+    }
+
+    achievements, err := b.DB.ListAchievements()
+    if err != nil {
+        c.Reply("Error fetching achievements.")
+        log.Printf("List achievements error: %v", err)
+        return
+    }
+    unlocked, err := b.DB.ListUserAchievements(c.GuildID, userID)
+    if err != nil {
+        c.Reply("Error fetching badges.")
+        log.Printf("Badges error: %v", err)
+        return
+    }
+
+    var response strings.Builder
+    response.WriteString("**Badges**\n")
+    response.WriteString(fmt.Sprintf("Player: <@%s> (%d of %d unlocked)\n\n", userID, len(unlocked), len(achievements)))
+    if len(unlocked) == 0 {
+        response.WriteString("No badges yet. Answer questions correctly to earn them!\n")
+    }
+    have := make(map[string]bool)
+    for _, u := range unlocked {
+        have[u.Key] = true
+        response.WriteString(fmt.Sprintf("**%s**: %s (<t:%d:d>)\n", u.Name, u.Description, u.UnlockedAt.Unix()))
+    }
+
+    var locked []string
+    for _, a := range achievements {
+        if !have[a.Key] {
+            locked = append(locked, a.Name)
+        }
+    }
+    if len(locked) > 0 {
+        response.WriteString("\nStill locked: " + strings.Join(locked, ", "))
+    }
+    c.Reply(response.String())
+}
+
+const achievementUsage = "Usage: `!!trivia achievement list`, `!!trivia achievement add <name> | <description> | <metric>=<threshold>` or `!!trivia achievement remove <key>`"
+
+// nonKeyChars are replaced to turn an achievement's name into its key.
+var nonKeyChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// handleAchievement lists, adds and removes achievement definitions. The
+// definitions are shared by every server, so only the bot's own admins can
+// change them.
+func (b *Bot) handleAchievement(c *Context) {
+    action, rest := cutWord(c.Args)
+    action = strings.ToLower(action)
+    if (action == "add" || action == "remove") && !b.isBotAdmin(c) {
+        c.Reply("Achievements are shared by every server, so only the bot's admins can add or remove them.")
+        return
+    }
+    switch action {
+    case "", "list":
+        b.listAchievements(c)
+    case "add":
+        a, err := parseAchievement(rest)
+        if err != nil {
+            c.Reply(fmt.Sprintf("Error: %s.\n%s", err, b.prefixed(c.GuildID, achievementUsage)))
+            return
+        }
+        achievements, err := b.DB.ListAchievements()
+        if err != nil {
+            c.Reply("Error fetching achievements.")
+            log.Printf("List achievements error: %v", err)
+            return
+        }
+        for _, existing := range achievements {
+            if existing.Key == a.Key {
+                c.Reply(fmt.Sprintf("An achievement with the key `%s` already exists. Remove it first or pick another name.", a.Key))
+                return
+            }
+        }
+        if err := b.DB.AddAchievement(a); err != nil {
+            c.Reply("Error adding achievement.")
+            log.Printf("Add achievement error: %v", err)
+            return
+        }
+        c.Reply(fmt.Sprintf("Achievement **%s** added with the key `%s`. Players can start unlocking it in their next game.", a.Name, a.Key))
+        log.Printf("Achievement %s added by %s", a.Key, c.Author.Username)
+    case "remove":
+        err := b.DB.RemoveAchievement(strings.ToLower(rest))
+        if errors.Is(err, sql.ErrNoRows) {
+            c.Reply(b.prefixed(c.GuildID, "No achievement with that key. Use `!!trivia achievement list` to see them."))
+            return
+        }
+        if err != nil {
+            c.Reply("Error removing achievement.")
+            log.Printf("Remove achievement error: %v", err)
+            return
+        }
+        c.Reply("Achievement removed, along with every badge earned for it.")
+        log.Printf("Achievement %s removed by %s", rest, c.Author.Username)
+    default:
+        c.Reply(b.prefixed(c.GuildID, achievementUsage))
+    }
+}
+
+func (b *Bot) listAchievements(c *Context) {
+    achievements, err := b.DB.ListAchievements()
+    if err != nil {
+        c.Reply("Error fetching achievements.")
+        log.Printf("List achievements error: %v", err)
+        return
+    }
+
+    var response strings.Builder
+    response.WriteString("**Achievements**\n")
+    if len(achievements) == 0 {
+        response.WriteString("None yet.\n")
+    }
+    for _, a := range achievements {
+        response.WriteString(fmt.Sprintf("`%s` **%s**: %s (%s=%d)\n", a.Key, a.Name, a.Description, a.Metric, a.Threshold))
+    }
+    response.WriteString("\nMetrics:\n")
+    for _, metric := range achievementMetrics {
+        response.WriteString(fmt.Sprintf("- `%s`: %s\n", metric.name, metric.description))
+    }
+    c.Reply(response.String())
+}
+
+// parseAchievement reads `<name> | <description> | <metric>=<threshold>`.
+func parseAchievement(args string) (*db.Achievement, error) {
+    parts := strings.Split(args, "|")
+    if len(parts) != 3 {
+        return nil, fmt.Errorf("give a name, a description and a rule, separated by |")
+    }
+    a := &db.Achievement{
+        Name:        strings.TrimSpace(parts[0]),
+        Description: strings.TrimSpace(parts[1]),
+    }
+    if a.Name == "" || len(a.Name) > 50 {
+        return nil, fmt.Errorf("the name must be 1 to 50 characters")
+    }
+    if a.Description == "" || len(a.Description) > 200 {
+        return nil, fmt.Errorf("the description must be 1 to 200 characters")
+    }
+    a.Key = strings.Trim(nonKeyChars.ReplaceAllString(strings.ToLower(a.Name), "_"), "_")
+    if a.Key == "" {
+        return nil, fmt.Errorf("the name needs at least one letter or digit")
+    }
+
+    name, value, ok := strings.Cut(strings.TrimSpace(parts[2]), "=")
+    metric := findMetric(strings.ToLower(strings.TrimSpace(name)))
+    if !ok || metric == nil {
+        return nil, fmt.Errorf("the rule must be <metric>=<threshold>, with a metric from %s", strings.Join(metricNames(), ", "))
+    }
+    threshold, err := parseBounded("the threshold", strings.TrimSpace(value), 1, 100000)
+    if err != nil {
+        return nil, err
+    }
+    a.Metric = metric.name
+    a.Threshold = threshold
+    return a, nil
+}
@@ -1,43 +1,63 @@
 package bot
 
 import (
+    "errors"
     "log"
-    "os"
+    "slices"
     "strings"
+    "sync"
 
+    "github.com/airylvat/trivia-bot/answer"
+    "github.com/airylvat/trivia-bot/config"
     "github.com/airylvat/trivia-bot/db"
+    "github.com/airylvat/trivia-bot/metrics"
 
     "github.com/bwmarrin/discordgo"
-    "github.com/joho/godotenv"
 )
 
 type Bot struct {
     Session   *discordgo.Session
-    DB        *db.DB
-    Trivia    *Trivia
-    AdminID   string
-    AdminRoleID string
+    Transport Transport
+    DB        db.Store
+    Config    *config.Config
+    Games     *Games
+    Matcher   *answer.Matcher
+    Dashboard Dashboard // Set when the web dashboard is enabled
+    imports   pendingImports
+    settings  settingsCache
+    commands  drain // Commands being handled, closed on shutdown
+    loops     sync.WaitGroup // Running game loops
 }
 
-func (b *Bot) isAdmin(s *discordgo.Session, m *discordgo.MessageCreate) bool {
-    // Check if the user is the hardcoded admin
-    if m.Author.ID == b.AdminID {
+// isBotAdmin reports whether the user is one of the configured admins, who
+// can also change what every server shares.
+func (b *Bot) isBotAdmin(c *Context) bool {
+    return slices.Contains(b.Config.AdminIDs, c.Author.ID)
+}
+
+func (b *Bot) isAdmin(c *Context) bool {
+    if b.isBotAdmin(c) {
         return true
     }
 
-    // Check if the user has the admin role
-    if b.AdminRoleID == "" {
-        return false // No admin role configured
+    // Check if the user has an admin role, bot-wide or set for the guild
+    roles := append(slices.Clone(b.Config.AdminRoleIDs), b.guildSettings(c.GuildID).AdminRoles...)
+    if len(roles) == 0 {
+        return false // No admin roles configured
     }
 
-    member, err := s.GuildMember(m.GuildID, m.Author.ID)
-    if err != nil {
-        log.Printf("Error fetching member roles: %v", err)
-        return false
+    member := c.Member
+    if member == nil {
+        var err error
+        member, err = c.Transport.GuildMember(c.GuildID, c.Author.ID)
+        if err != nil {
+            log.Printf("Error fetching member roles: %v", err)
+            return false
+        }
     }
 
     for _, roleID := range member.Roles {
-        if roleID == b.AdminRoleID {
+        if slices.Contains(roles, roleID) {
             return true
         }
     }
@@ -45,97 +65,119 @@ func (b *Bot) isAdmin(s *discordgo.Session, m *discordgo.MessageCreate) bool {
     return false
 }
 
-func NewBot() (*Bot, error) {
-    if err := godotenv.Load(); err != nil {
-        return nil, err
+func NewBot(cfg *config.Config) (*Bot, error) {
+    if cfg.Token == "" {
+        return nil, errors.New("DISCORD_TOKEN is not set in the environment, .env or the config file")
     }
 
-    token := os.Getenv("DISCORD_TOKEN")
-    adminID := os.Getenv("ADMIN_ID")
-    adminRoleID := os.Getenv("ADMIN_ROLE_ID")
-
-    session, err := discordgo.New("Bot " + token)
+    session, err := discordgo.New("Bot " + cfg.Token)
     if err != nil {
         return nil, err
     }
 
-    db, err := db.NewDB()
+    db, err := db.NewStore(cfg.Storage, cfg.DatabasePath, cfg.DefaultGuildID)
     if err != nil {
         return nil, err
     }
 
-    bot := &Bot{
-        Session: session,
-        DB:      db,
-        Trivia:  NewTrivia(),
-        AdminID: adminID,
-        AdminRoleID: adminRoleID,
-    }
+    bot := NewBotWithTransport(cfg, NewDiscordTransport(session), db)
+    bot.Session = session
 
     session.AddHandler(bot.handleMessage)
+    session.AddHandler(bot.handleInteraction)
     return bot, nil
 }
 
+// NewBotWithTransport builds a bot that talks through transport instead of a
+// Discord session, e.g. a FakeTransport for playing games offline. Feed it
+// events with HandleMessage and HandleInteraction; Start is not used.
+func NewBotWithTransport(cfg *config.Config, transport Transport, store db.Store) *Bot {
+    return &Bot{
+        Transport: transport,
+        DB:        store,
+        Config:    cfg,
+        Games:     NewGames(),
+        Matcher:   answer.NewMatcher(cfg.AnswerTolerance),
+    }
+}
+
 func (b *Bot) Start() error {
     if err := b.Session.Open(); err != nil {
         return err
     }
     log.Println("Bot is running...")
     log.Printf("Logged in as: %s#%s\n", b.Session.State.User.Username, b.Session.State.User.Discriminator)
-    log.Printf("Admin ID: %s\n", b.AdminID)
-    log.Printf("Admin Role ID: %s\n", b.AdminRoleID)
-    log.Printf("Allowed Channels: %s\n", os.Getenv("ALLOWED_CHANNELS"))
+
+    if err := b.registerSlashCommands(); err != nil {
+        log.Printf("Error registering slash commands: %v", err)
+    }
+    b.ResumeGames()
     return nil
 }
 
+// channelAllowed reports whether commands may be used in the channel.
+func (b *Bot) channelAllowed(guildID, channelID string) bool {
+    // With no channels configured the bot stays silent everywhere
+    return slices.Contains(b.guildSettings(guildID).AllowedChannels, channelID)
+}
+
 func (b *Bot) handleMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
     if m.Author.ID == s.State.User.ID {
         return
     }
+    b.HandleMessage(m)
+}
+
+// HandleMessage runs a prefix command such as `!!trivia join red`.
+func (b *Bot) HandleMessage(m *discordgo.MessageCreate) {
+    if !b.commands.start() {
+        return // Shutting down
+    }
+    defer b.commands.done()
 
-    allowedChannels := strings.Split(os.Getenv("ALLOWED_CHANNELS"), ",")
-    if len(allowedChannels) == 0 || allowedChannels[0] == "" {
-        // If no channels are specified, respond in all channels
+    prefix := b.guildSettings(m.GuildID).Prefix
+    fields := strings.Fields(m.Content)
+    if len(fields) < 2 || fields[0] != prefix {
         return
     }
 
-    allowed := false
-    for _, channelID := range allowedChannels {
-        if m.ChannelID == strings.TrimSpace(channelID) {
-            allowed = true
-            break
-        }
+    cmd, ok := commandsByName[fields[1]]
+    if !ok {
+        return
     }
-    if !allowed {
+    if !cmd.anyChannel && !b.channelAllowed(m.GuildID, m.ChannelID) {
+        metrics.Commands.WithLabelValues(cmd.name, metrics.OutcomeWrongChannel).Inc()
         return
     }
 
-    switch {
-    case m.Content == "!!trivia start" && b.isAdmin(s, m):
-        b.handleStart(s, m)
-    case m.Content == "!!trivia help":
-        b.handleHelp(s, m)
-    case m.Content == "!!trivia scores":
-        b.handleScores(s, m)
-    case m.Content == "!!trivia end" && b.isAdmin(s, m):
-        b.handleEnd(s, m)
-    case m.Content == "!!trivia next" && b.isAdmin(s, m):
-        b.handleNext(s, m)
-    case m.Content == "!!trivia reset" && b.isAdmin(s, m):
-        b.handleReset(s, m)
-    case len(m.Content) > len("!!trivia join ") && m.Content[:13] == "!!trivia join":
-        b.handleJoin(s, m)
-    case len(m.Content) > len("!!trivia answer ") && m.Content[:15] == "!!trivia answer":
-        b.handleAnswer(s, m)
-    case len(m.Content) > len("!!trivia addq ") && m.Content[:13] == "!!trivia addq" && b.isAdmin(s, m):
-        b.handleAddQuestion(s, m)
-    case len(m.Content) > len("!!trivia removeq ") && m.Content[:16] == "!!trivia removeq" && b.isAdmin(s, m):
-        b.handleRemoveQuestion(s, m)
-    case m.Content == "!!trivia list" && b.isAdmin(s, m):
-        b.handleListQuestions(s, m, "count")
-    case m.Content == "!!trivia list answers" && b.isAdmin(s, m):
-        b.handleListQuestions(s, m, "answers")
-    case m.Content == "!!trivia list questions" && b.isAdmin(s, m):
-        b.handleListQuestions(s, m, "count")
+    // Keep the user's original spacing in the arguments
+    args := strings.TrimSpace(strings.TrimSpace(m.Content)[len(prefix):])
+    args = strings.TrimSpace(args[len(fields[1]):])
+
+    c := newMessageContext(b.Transport, m, args)
+    if cmd.admin && !b.isAdmin(c) {
+        metrics.Commands.WithLabelValues(cmd.name, metrics.OutcomeForbidden).Inc()
+        return
     }
+    cmd.handler(b, c)
+    metrics.Commands.WithLabelValues(cmd.name, c.outcome()).Inc()
+}
+
+// RegisterMetrics adds the gauges read from the bot when metrics are scraped.
+func (b *Bot) RegisterMetrics() {
+    metrics.RegisterGauges(
+        func() float64 { return float64(len(b.Games.Active(""))) },
+        func() float64 {
+            categories, err := b.DB.ListCategories()
+            if err != nil {
+                log.Printf("Error counting questions for metrics: %v", err)
+                return 0
+            }
+            total := 0
+            for _, c := range categories {
+                total += c.Count
+            }
+            return float64(total)
+        },
+    )
 }
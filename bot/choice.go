@@ -0,0 +1,135 @@
+package bot
+
+import (
+    "fmt"
+    "log"
+    "strings"
+
+    "github.com/airylvat/trivia-bot/db"
+    "github.com/bwmarrin/discordgo"
+)
+
+const (
+    choiceLetters      = "ABCD"
+    maxDistractors     = db.MaxDistractors
+    choiceButtonPrefix = "trivia_choice:"
+)
+
+// choiceButtons builds one A/B/C/D button per option. Custom IDs carry the
+// question ID so clicks on an old question's buttons can be told apart.
+func choiceButtons(questionID int, options []string, disabled bool) []discordgo.MessageComponent {
+    var buttons []discordgo.MessageComponent
+    for i := range options {
+        buttons = append(buttons, discordgo.Button{
+            Label:    string(choiceLetters[i]),
+            Style:    discordgo.PrimaryButton,
+            CustomID: fmt.Sprintf("%s%d:%d", choiceButtonPrefix, questionID, i),
+            Disabled: disabled,
+        })
+    }
+    return []discordgo.MessageComponent{discordgo.ActionsRow{Components: buttons}}
+}
+
+// postChoiceQuestion posts a multiple-choice question with its answer buttons
+// and remembers the message so the buttons can be disabled when it closes.
+func (b *Bot) postChoiceQuestion(t *Trivia, embed *discordgo.MessageEmbed) error {
+    questionID := t.Current.ID
+    options := t.Options
+
+    var description strings.Builder
+    description.WriteString(embed.Description + "\n")
+    for i, option := range options {
+        description.WriteString(fmt.Sprintf("\n**%c)** %s", choiceLetters[i], option))
+    }
+    embed.Description = description.String()
+    embed.Footer = &discordgo.MessageEmbedFooter{
+        Text: "Click a button to answer. Only your first click counts, and the fastest correct answers earn points.",
+    }
+
+    msg, err := b.Transport.ChannelMessageSendComplex(t.ChannelID, &discordgo.MessageSend{
+        Embeds:     []*discordgo.MessageEmbed{embed},
+        Components: choiceButtons(questionID, options, false),
+    })
+    if err != nil {
+        return err
+    }
+
+    t.MessageID = msg.ID
+    return nil
+}
+
+// revealChoices disables a closed multiple-choice question's buttons and
+// posts how many players picked each option.
+func (b *Bot) revealChoices(t *Trivia, result *QuestionResult, timeUp bool) {
+    tally := result.Tally
+    if tally.MessageID != "" {
+        components := choiceButtons(result.Question.ID, tally.Options, true)
+        if _, err := b.Transport.ChannelMessageEditComplex(&discordgo.MessageEdit{
+            Channel:    t.ChannelID,
+            ID:         tally.MessageID,
+            Components: &components,
+        }); err != nil {
+            log.Printf("Error disabling answer buttons: %v", err)
+        }
+    }
+
+    var description strings.Builder
+    for i, option := range tally.Options {
+        line := fmt.Sprintf("%c) %s: %d", choiceLetters[i], option, tally.Counts[i])
+        if i == tally.Correct {
+            line = "**" + line + " (correct)**"
+        }
+        description.WriteString(line + "\n")
+    }
+    if len(result.Awards) == 0 {
+        description.WriteString("\nNobody picked the correct answer.")
+    }
+    for _, award := range result.Awards {
+        description.WriteString(fmt.Sprintf("\n%s correct answer: <@%s> (+%d points)", ordinal(award.Rank), award.UserID, award.Points))
+    }
+
+    title := fmt.Sprintf("Results for Question # %d", result.Question.ID)
+    if timeUp {
+        title = "Time's up! " + title
+    }
+    embed := &discordgo.MessageEmbed{
+        Title:       title,
+        Description: description.String(),
+        Color:       0x0000ff, // Blue sidebar
+    }
+    if _, err := b.Transport.ChannelMessageSendEmbed(t.ChannelID, embed); err != nil {
+        log.Printf("Embed error: %v", err)
+    }
+}
+
+func (b *Bot) handleChoice(c *Context) {
+    var questionID, option int
+    customID := c.Interaction.MessageComponentData().CustomID
+    if _, err := fmt.Sscanf(customID, choiceButtonPrefix+"%d:%d", &questionID, &option); err != nil {
+        log.Printf("Invalid choice button %q: %v", customID, err)
+        return
+    }
+
+    // The game records the pick and replies
+    t := b.Games.Get(c.GuildID, c.ChannelID)
+    if t == nil || t.Pick(c, questionID, option) != nil {
+        c.ReplyPrivate("This question is closed.")
+    }
+}
+
+// ordinal formats 1 as "1st", 2 as "2nd" and so on.
+func ordinal(n int) string {
+    suffix := "th"
+    switch n % 10 {
+    case 1:
+        suffix = "st"
+    case 2:
+        suffix = "nd"
+    case 3:
+        suffix = "rd"
+    }
+    if n%100 >= 11 && n%100 <= 13 {
+        suffix = "th"
+    }
+    return fmt.Sprintf("%d%s", n, suffix)
+}
@@ -1,180 +1,416 @@
 package bot
 
 import (
+    "database/sql"
+    "errors"
     "fmt"
     "log"
+    "github.com/airylvat/trivia-bot/db"
+    "github.com/airylvat/trivia-bot/metrics"
     "github.com/bwmarrin/discordgo"
+    "regexp"
     "strconv"
     "strings"
     "time"
 )
 
-const (
-    timeoutLength = 10 // Minutes
-)
-func (b *Bot) handleStart(s *discordgo.Session, m *discordgo.MessageCreate) {
-    if b.Trivia.Active {
-        s.ChannelMessageSendReply(m.ChannelID, "Trivia is already running!", m.Reference())
-        return
+var optionKey = regexp.MustCompile(`(?:^|\s)([a-zA-Z]+)=`)
+
+// parseOptions splits arguments like "Old Testament difficulty=easy tag=kings"
+// into the leading text and its key=value options. Values may contain spaces.
+func parseOptions(args string) (string, map[string]string) {
+    options := make(map[string]string)
+    matches := optionKey.FindAllStringSubmatchIndex(args, -1)
+    if len(matches) == 0 {
+        return strings.TrimSpace(args), options
+    }
+
+    rest := strings.TrimSpace(args[:matches[0][0]])
+    for i, m := range matches {
+        end := len(args)
+        if i+1 < len(matches) {
+            end = matches[i+1][0]
+        }
+        options[strings.ToLower(args[m[2]:m[3]])] = strings.TrimSpace(args[m[1]:end])
     }
+    return rest, options
+}
 
-    b.Trivia.Start()
-    s.ChannelMessageSend(m.ChannelID, "Trivia started! Use `!!trivia join <team>` to join a team. Admin, use `!!trivia next` to post the first question. Use `!!trivia help` for more commands.")
-    log.Printf("Trivia started by %s\n", m.Author.Username)
+// gameOptions are the settings chosen with `!!trivia start`.
+type gameOptions struct {
+    Filter        db.QuestionFilter
+    QuestionTime  time.Duration
+    Intermission  time.Duration
+    QuestionLimit int
+    Scoring       ScoringRule
+    PartialCredit bool
+}
 
-    go b.runTrivia(s, m.ChannelID)
+const startUsage = "Usage: `!!trivia start [category=<name>] [difficulty=easy|medium|hard] [tag=<tag>] [timer=<seconds>] [intermission=<seconds>] [questions=<count>] [scoring=classic|speed|difficulty] [partial=yes]`"
 
-    b.Trivia.NextChan <- struct{}{}
+// parseBounded reads a whole number option and checks it is within range.
+func parseBounded(key, value string, min, max int) (int, error) {
+    n, err := strconv.Atoi(value)
+    if err != nil || n < min || n > max {
+        return 0, fmt.Errorf("%s must be a number from %d to %d", key, min, max)
+    }
+    return n, nil
 }
 
-func (b *Bot) runTrivia(s *discordgo.Session, channelID string) {
-    for b.Trivia.Active {
-        select {
-        case <-b.Trivia.NextChan:
-        case <-time.After(5 * time.Minute):
-            s.ChannelMessageSend(channelID, "Trivia timed out due to inactivity. Ending game.")
-            b.Trivia.End()
-            return
+// parseGameOptions reads `!!trivia start` arguments. A bare word is taken as
+// a difficulty if it names one, and as a category otherwise. Timers and the
+// category default to the guild's settings.
+func parseGameOptions(args string, settings GuildSettings) (gameOptions, error) {
+    opts := gameOptions{Scoring: classicScoring{}}
+    rest, options := parseOptions(args)
+    if rest != "" {
+        if difficulty, err := db.ParseDifficulty(rest); err == nil {
+            opts.Filter.Difficulty = difficulty
+        } else {
+            opts.Filter.Category = rest
         }
+    }
 
-        q, err := b.DB.GetRandomQuestion()
-        if err != nil {
-            s.ChannelMessageSend(channelID, "Error fetching question. Ending trivia.")
-            b.Trivia.End()
-            return
+    for key, value := range options {
+        switch key {
+        case "category":
+            opts.Filter.Category = value
+        case "tag":
+            opts.Filter.Tag = value
+        case "difficulty":
+            difficulty, err := db.ParseDifficulty(value)
+            if err != nil {
+                return opts, err
+            }
+            opts.Filter.Difficulty = difficulty
+        case "timer":
+            seconds, err := parseBounded(key, value, 5, 3600)
+            if err != nil {
+                return opts, err
+            }
+            opts.QuestionTime = time.Duration(seconds) * time.Second
+        case "intermission":
+            seconds, err := parseBounded(key, value, 0, 600)
+            if err != nil {
+                return opts, err
+            }
+            opts.Intermission = time.Duration(seconds) * time.Second
+        case "questions":
+            count, err := parseBounded(key, value, 1, 1000)
+            if err != nil {
+                return opts, err
+            }
+            opts.QuestionLimit = count
+        case "scoring":
+            rule, ok := scoringRules[strings.ToLower(value)]
+            if !ok {
+                return opts, fmt.Errorf("scoring must be one of %s", strings.Join(scoringNames(), ", "))
+            }
+            opts.Scoring = rule
+        case "partial":
+            partial, err := parseSwitch(value)
+            if err != nil {
+                return opts, fmt.Errorf("partial: %w", err)
+            }
+            opts.PartialCredit = partial
+        default:
+            return opts, fmt.Errorf("unknown option %q", key)
         }
+    }
 
-        b.Trivia.SetQuestion(q)
-        questionText := strings.TrimSpace(q.Text)
-        questionNumber := b.Trivia.Current.ID
-        log.Printf("Posting question: %q - %q", questionNumber, questionText)
-
-        embed := &discordgo.MessageEmbed{
-            Title:       "Trivia Question # " + strconv.Itoa(questionNumber),
-            Description: questionText,
-            Color:       0x00ff00, // Green sidebar
-            Footer: &discordgo.MessageEmbedFooter{
-                Text: "Use !!trivia answer <answer> to respond (case-insensitive). Only the first correct answer earns points.",
-            },
-        }
+    if _, ok := options["timer"]; !ok {
+        opts.QuestionTime = settings.QuestionTime
+    }
+    if _, ok := options["intermission"]; !ok && opts.QuestionTime > 0 {
+        opts.Intermission = settings.Intermission
+    }
+    if opts.Filter.Category == "" {
+        opts.Filter.Category = settings.DefaultCategory
+    } else if strings.EqualFold(opts.Filter.Category, "any") {
+        opts.Filter.Category = ""
+    }
 
-        _, err = s.ChannelMessageSendEmbed(channelID, embed)
-        if err != nil {
-            s.ChannelMessageSend(channelID, "Error posting question. Ending trivia.")
-            log.Printf("Embed error: %v", err)
-            b.Trivia.End()
-            return
-        }
+    if opts.Intermission > 0 && opts.QuestionTime == 0 {
+        return opts, fmt.Errorf("automatic games need a question timer, e.g. `timer=30 intermission=10`")
+    }
+    return opts, nil
+}
+
+func (b *Bot) handleStart(c *Context) {
+    settings := b.guildSettings(c.GuildID)
+    opts, err := parseGameOptions(c.Args, settings)
+    if err != nil {
+        c.Reply("Error: " + err.Error() + "\n" + b.prefixed(c.GuildID, startUsage))
+        return
+    }
+
+    t := NewTrivia(c.GuildID, c.ChannelID)
+    t.Filter = opts.Filter
+    t.QuestionTime = opts.QuestionTime
+    t.Intermission = opts.Intermission
+    t.QuestionLimit = opts.QuestionLimit
+    t.Scoring = opts.Scoring
+    t.PartialCredit = opts.PartialCredit
+    t.BasePoints = settings.Points
+    t.IdleTimeout = settings.IdleTimeout
+    if !b.Games.Start(t) {
+        c.Reply("Trivia is already running in this channel!")
+        return
+    }
+
+    if !opts.Filter.IsEmpty() {
+        c.Send(fmt.Sprintf("This game only uses questions matching: %s.", opts.Filter))
+    }
+    rules := []string{fmt.Sprintf("%s scoring (%s)", opts.Scoring.Name(), opts.Scoring.Description())}
+    if settings.Points != basePoints {
+        rules = append(rules, fmt.Sprintf("%d base points per answer", settings.Points))
+    }
+    if opts.PartialCredit {
+        rules = append(rules, "the 2nd and 3rd correct answers earn partial credit")
+    }
+    if opts.QuestionLimit > 0 {
+        rules = append(rules, fmt.Sprintf("%d questions", opts.QuestionLimit))
+    }
+    if opts.QuestionTime > 0 {
+        rules = append(rules, fmt.Sprintf("%d seconds per question", int(opts.QuestionTime.Seconds())))
+    }
+    if opts.Intermission > 0 {
+        rules = append(rules, fmt.Sprintf("next question posted automatically after %d seconds", int(opts.Intermission.Seconds())))
+    }
+    gameID, err := b.DB.StartGame(c.GuildID, c.ChannelID, c.Author.ID, strings.Join(rules, ", "))
+    if err != nil {
+        b.releaseGame(t)
+        c.Reply("Error starting game.")
+        log.Printf("Start game error: %v", err)
+        return
+    }
+    t.GameID = gameID
+    metrics.GamesStarted.Inc()
+    b.saveGame(t)
+
+    c.Send(fmt.Sprintf("Game #%d rules: %s.", gameID, strings.Join(rules, ", ")))
+    c.Send(b.prefixed(c.GuildID, "Trivia started! Use `!!trivia join <team>` to join a team. Admin, use `!!trivia next` to post the first question. Use `!!trivia help` for more commands."))
+    log.Printf("Trivia started by %s in channel %s\n", c.Author.Username, c.ChannelID)
+
+    b.loops.Add(1)
+    go func() {
+        defer b.loops.Done()
+        b.runTrivia(t)
+    }()
+
+    t.Next()
+}
+
+// questionFields shows a question's category and difficulty in its embed.
+func questionFields(q *db.Question) []*discordgo.MessageEmbedField {
+    fields := []*discordgo.MessageEmbedField{
+        {Name: "Difficulty", Value: db.DifficultyName(q.Difficulty), Inline: true},
+    }
+    if q.Category != "" {
+        fields = append([]*discordgo.MessageEmbedField{{Name: "Category", Value: q.Category, Inline: true}}, fields...)
+    }
+    return fields
+}
+
+// postQuestion posts the game's current question.
+func (b *Bot) postQuestion(t *Trivia) error {
+    q := t.Current
+    questionText := strings.TrimSpace(q.Text)
+    log.Printf("Posting question in channel %s: %q - %q", t.ChannelID, q.ID, questionText)
+
+    embed := &discordgo.MessageEmbed{
+        Title:       "Trivia Question # " + strconv.Itoa(q.ID),
+        Description: questionText,
+        Color:       0x00ff00, // Green sidebar
+        Fields:      append(questionFields(q), gameFields(t)...),
+        Footer: &discordgo.MessageEmbedFooter{
+            Text: b.prefixed(t.GuildID, "Use /trivia answer or !!trivia answer <answer> to respond (case-insensitive)."),
+        },
+    }
+
+    if q.IsChoice() {
+        return b.postChoiceQuestion(t, embed)
     }
+    _, err := b.Transport.ChannelMessageSendEmbed(t.ChannelID, embed)
+    return err
 }
 
-func (b *Bot) handleJoin(s *discordgo.Session, m *discordgo.MessageCreate) {
-    team := strings.ToLower(strings.TrimSpace(m.Content[13:]))
+// gameFields shows the game's progress and the question's countdown in its embed.
+func gameFields(t *Trivia) []*discordgo.MessageEmbedField {
+    var fields []*discordgo.MessageEmbedField
+    if t.QuestionLimit > 0 {
+        fields = append(fields, &discordgo.MessageEmbedField{Name: "Question", Value: fmt.Sprintf("%d of %d", t.Asked, t.QuestionLimit), Inline: true})
+    }
+    if !t.Deadline.IsZero() {
+        // Discord renders relative timestamps as a live countdown
+        fields = append(fields, &discordgo.MessageEmbedField{Name: "Time left", Value: fmt.Sprintf("Ends <t:%d:R>", t.Deadline.Unix()), Inline: true})
+    }
+    return fields
+}
+
+func (b *Bot) handleJoin(c *Context) {
+    team := strings.ToLower(c.Args)
     if team == "" {
-        s.ChannelMessageSendReply(m.ChannelID, "Please specify a team name.", m.Reference())
+        c.Reply("Please specify a team name.")
         return
     }
 
-    if err := b.DB.JoinTeam(m.Author.ID, team); err != nil {
-        s.ChannelMessageSendReply(m.ChannelID, "Error joining team.", m.Reference())
+    if err := b.DB.JoinTeam(c.GuildID, c.Author.ID, team); err != nil {
+        c.Reply("Error joining team.")
         return
     }
 
-    s.ChannelMessageSendReply(m.ChannelID, fmt.Sprintf("%s joined team %s!", m.Author.Username, team), m.Reference())
-    log.Printf("User %s joined team %s\n", m.Author.Username, team)
+    c.Reply(fmt.Sprintf("%s joined team %s!", c.Author.Username, team))
+    log.Printf("User %s joined team %s\n", c.Author.Username, team)
 }
 
-func (b *Bot) handleAnswer(s *discordgo.Session, m *discordgo.MessageCreate) {
-    if !b.Trivia.Active || b.Trivia.Current == nil {
-        s.ChannelMessageSendReply(m.ChannelID, "No active trivia question.", m.Reference())
+func (b *Bot) handleAnswer(c *Context) {
+    t := b.Games.Get(c.GuildID, c.ChannelID)
+    if t == nil {
+        c.Reply("No active trivia question in this channel.")
         return
     }
 
-    b.Trivia.Mutex.Lock()
-    if b.Trivia.AnsweredCorrect {
-        b.Trivia.Mutex.Unlock()
-        s.ChannelMessageSendReply(m.ChannelID, "This question has already been answered correctly. Wait for the next question.", m.Reference())
+    if c.Args == "" {
+        c.ReplyPrivate(b.prefixed(c.GuildID, "Usage: `!!trivia answer <answer>`"))
         return
     }
-    b.Trivia.Mutex.Unlock()
 
-    answer := strings.TrimSpace(m.Content[15:])
-    player, err := b.DB.Query("SELECT team FROM players WHERE user_id = ?", m.Author.ID)
-    if err != nil || !player.Next() {
-        s.ChannelMessageSendReply(m.ChannelID, "You must join a team first with `!!trivia join <team>`.", m.Reference())
+    // The game checks the answer and replies
+    if err := t.Answer(c); err != nil {
+        c.Reply("No active trivia question in this channel.")
+    }
+}
+
+// countAnswer records an answer in the metrics, along with how long the
+// first correct answer to a question took.
+func countAnswer(correct bool, award *Award) {
+    if !correct {
+        metrics.Answers.WithLabelValues(metrics.Incorrect).Inc()
         return
     }
-    var team string
-    player.Scan(&team)
-    player.Close()
-
-    team = strings.TrimSpace(team)
-    log.Printf("Comparing answer: user=%q, correct=%q, team=%q", answer, b.Trivia.Current.Answer, team)
-    if strings.EqualFold(answer, strings.TrimSpace(b.Trivia.Current.Answer)) {
-        b.Trivia.Mutex.Lock()
-        if b.Trivia.AnsweredCorrect { // Double-check in case of race
-            b.Trivia.Mutex.Unlock()
-            s.ChannelMessageSendReply(m.ChannelID, "This question has already been answered correctly. Wait for the next question.", m.Reference())
-            return
+    metrics.Answers.WithLabelValues(metrics.Correct).Inc()
+    if award != nil && award.Rank == 1 {
+        metrics.TimeToFirstCorrect.Observe(award.Elapsed.Seconds())
+    }
+}
+
+// rankLabel describes a correct answer's place when it isn't the first.
+func rankLabel(rank int) string {
+    if rank <= 1 {
+        return ""
+    }
+    return "(" + ordinal(rank) + ") "
+}
+
+// parseSwitch reads yes/no style option values.
+func parseSwitch(value string) (bool, error) {
+    switch strings.ToLower(strings.TrimSpace(value)) {
+    case "yes", "y", "on", "true", "1":
+        return true, nil
+    case "no", "n", "off", "false", "0":
+        return false, nil
+    }
+    return false, fmt.Errorf("expected yes or no, got %q", value)
+}
+
+const addQuestionUsage = "Usage: `!!trivia addq <question> | <answer> [| <wrong answer>...] [| aliases=<alias>; <alias>] [| exact=yes] [| category=<name>] [| tags=<tag>, <tag>] [| difficulty=easy|medium|hard]`"
+
+// parseQuestion reads the `addq` arguments: the question, the answer, up to
+// three wrong answers for multiple choice, and any `key=value` options.
+func parseQuestion(args string) (*db.Question, error) {
+    var parts []string
+    q := &db.Question{Kind: db.KindText}
+    for _, part := range strings.Split(args, "|") {
+        part = strings.TrimSpace(part)
+        key, value, isOption := strings.Cut(part, "=")
+        key = strings.ToLower(strings.TrimSpace(key))
+        value = strings.TrimSpace(value)
+        if !isOption || len(parts) < 2 {
+            parts = append(parts, part)
+            continue
         }
-        b.Trivia.AnsweredCorrect = true
-        b.Trivia.Mutex.Unlock()
 
-        if err := b.DB.AddScore(m.Author.ID, team, 10); err != nil {
-            s.ChannelMessageSendReply(m.ChannelID, "Error updating score.", m.Reference())
-            log.Printf("Score update error: %v", err)
-            return
+        switch key {
+        case "aliases":
+            for _, alias := range strings.Split(value, ";") {
+                if alias = strings.TrimSpace(alias); alias != "" {
+                    q.Aliases = append(q.Aliases, alias)
+                }
+            }
+        case "exact":
+            exact, err := parseSwitch(value)
+            if err != nil {
+                return nil, fmt.Errorf("exact: %w", err)
+            }
+            q.ExactOnly = exact
+        case "category":
+            q.Category = value
+        case "tags":
+            for _, tag := range strings.Split(value, ",") {
+                if tag = strings.TrimSpace(tag); tag != "" {
+                    q.Tags = append(q.Tags, tag)
+                }
+            }
+        case "difficulty":
+            difficulty, err := db.ParseDifficulty(value)
+            if err != nil {
+                return nil, err
+            }
+            q.Difficulty = difficulty
+        default:
+            parts = append(parts, part) // Not an option, e.g. a wrong answer like "E=mc2"
         }
-        s.ChannelMessageSendReply(m.ChannelID, fmt.Sprintf("%s answered correctly for team %s! +10 points! Question closed, admin use `!!trivia next` for the next question.", m.Author.Username, team), m.Reference())
-    } else {
-        s.ChannelMessageSendReply(m.ChannelID, "Incorrect answer.", m.Reference())
     }
+
+    if len(parts) < 2 || len(parts) > 2+maxDistractors {
+        return nil, fmt.Errorf("%s", addQuestionUsage)
+    }
+    q.Text, q.Answer = parts[0], parts[1]
+    if len(parts) > 2 {
+        q.Kind = db.KindChoice
+        q.Distractors = parts[2:]
+    }
+    return q, q.Validate()
 }
 
-func (b *Bot) handleAddQuestion(s *discordgo.Session, m *discordgo.MessageCreate) {
-    parts := strings.SplitN(m.Content[13:], "|", 2)
-    if len(parts) != 2 {
-        s.ChannelMessageSend(m.ChannelID, "Usage: `!!trivia addq <question> | <answer>`")
+func (b *Bot) handleAddQuestion(c *Context) {
+    q, err := parseQuestion(c.Args)
+    if err != nil {
+        c.Reply("Error: " + err.Error() + "\n" + b.prefixed(c.GuildID, addQuestionUsage))
         return
     }
 
-    question, answer := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
-    if err := b.DB.AddQuestion(question, answer); err != nil {
-        s.ChannelMessageSendReply(m.ChannelID, "Error adding question.", m.Reference())
+    if err := b.DB.AddQuestion(q); err != nil {
+        c.Reply("Error adding question.")
         log.Println("Error adding question:", err)
         return
     }
 
-    s.ChannelMessageSendReply(m.ChannelID, "Question added successfully!", m.Reference())
-    log.Printf("Question added by %s: %q | %q\n", m.Author.Username, question, answer)
+    c.Reply(fmt.Sprintf("Question %d added successfully!", q.ID))
+    log.Printf("Question added by %s: %q | %q | %q\n", c.Author.Username, q.Text, q.Answer, q.Distractors)
 }
 
-func (b *Bot) handleRemoveQuestion(s *discordgo.Session, m *discordgo.MessageCreate) {
-    id, err := strconv.Atoi(strings.TrimSpace(m.Content[16:]))
+func (b *Bot) handleRemoveQuestion(c *Context) {
+    id, err := strconv.Atoi(c.Args)
     if err != nil {
-        s.ChannelMessageSendReply(m.ChannelID, "Invalid question ID.", m.Reference())
+        c.Reply("Invalid question ID.")
         return
     }
 
     if err := b.DB.RemoveQuestion(id); err != nil {
-        s.ChannelMessageSendReply(m.ChannelID, "Error removing question.", m.Reference())
+        c.Reply("Error removing question.")
         log.Println("Error removing question:", err)
         return
     }
 
-    s.ChannelMessageSendReply(m.ChannelID, "Question removed successfully!", m.Reference())
-    log.Printf("Question %d removed by %s\n", id, m.Author.Username)
+    c.Reply("Question removed successfully!")
+    log.Printf("Question %d removed by %s\n", id, c.Author.Username)
 }
 
-func (b *Bot) handleScores(s *discordgo.Session, m *discordgo.MessageCreate) {
-    players, teams, err := b.DB.GetScores()
-    if err != nil {
-        s.ChannelMessageSend(m.ChannelID, "Error fetching scores.")
-        return
-    }
-
-    var response strings.Builder
-    response.WriteString("**Scores**\n\n**Players**\n")
+// writeScoreboard lists players and teams with their scores.
+func writeScoreboard(response *strings.Builder, players []db.Player, teams []db.Team) {
+    response.WriteString("**Players**\n")
     for _, p := range players {
         response.WriteString(fmt.Sprintf("<@%s> (Team %s): %d\n", p.UserID, p.Team, p.Score))
     }
@@ -182,82 +418,226 @@ func (b *Bot) handleScores(s *discordgo.Session, m *discordgo.MessageCreate) {
     for _, t := range teams {
         response.WriteString(fmt.Sprintf("%s: %d\n", t.Name, t.Score))
     }
+}
+
+func (b *Bot) handleScores(c *Context) {
+    players, teams, err := b.DB.GetScores(c.GuildID)
+    if err != nil {
+        c.Send("Error fetching scores.")
+        return
+    }
+
+    var response strings.Builder
+    response.WriteString("**All-time Scores**\n\n")
+    writeScoreboard(&response, players, teams)
+
+    c.Send(response.String())
+    log.Printf("Scores requested by %s\n", c.Author.Username)
+}
+
+func (b *Bot) handleResults(c *Context) {
+    var game *db.Game
+    var err error
+    if c.Args == "" {
+        game, err = b.DB.LatestGame(c.GuildID)
+    } else {
+        id, convErr := strconv.Atoi(strings.TrimPrefix(c.Args, "#"))
+        if convErr != nil {
+            c.Reply(b.prefixed(c.GuildID, "Usage: `!!trivia results [game id]`"))
+            return
+        }
+        game, err = b.DB.GetGame(id)
+    }
+    if errors.Is(err, sql.ErrNoRows) || (err == nil && game.GuildID != c.GuildID) {
+        c.Reply(b.prefixed(c.GuildID, "No such game in this server. Use `!!trivia history` to see recent games."))
+        return
+    }
+    if err != nil {
+        c.Reply("Error fetching game.")
+        log.Printf("Game results error: %v", err)
+        return
+    }
+
+    players, teams, err := b.DB.GetGameScores(game.ID)
+    if err != nil {
+        c.Reply("Error fetching game scores.")
+        log.Printf("Game scores error: %v", err)
+        return
+    }
+
+    var response strings.Builder
+    response.WriteString(fmt.Sprintf("**Game #%d Results**\n", game.ID))
+    response.WriteString(fmt.Sprintf("Started <t:%d:f> by <@%s> in <#%s>\n", game.StartedAt.Unix(), game.StartedBy, game.ChannelID))
+    if game.EndedAt.IsZero() {
+        response.WriteString("Still in progress\n")
+    } else {
+        response.WriteString(fmt.Sprintf("Ended <t:%d:f> (%s) after %d questions\n", game.EndedAt.Unix(), game.EndReason, game.Questions))
+    }
+    if game.Rules != "" {
+        response.WriteString("Rules: " + game.Rules + "\n")
+    }
+    response.WriteString("\n")
+    if len(players) == 0 {
+        response.WriteString("Nobody scored in this game.")
+    } else {
+        writeScoreboard(&response, players, teams)
+    }
+
+    c.Send(response.String())
+}
+
+func (b *Bot) handleHistory(c *Context) {
+    games, err := b.DB.ListGames(c.GuildID, 10)
+    if err != nil {
+        c.Reply("Error fetching game history.")
+        log.Printf("Game history error: %v", err)
+        return
+    }
+    if len(games) == 0 {
+        c.Reply("No games have been played in this server yet.")
+        return
+    }
+
+    var response strings.Builder
+    response.WriteString("**Recent Games**\n")
+    for _, g := range games {
+        winner := "nobody scored"
+        if g.WinnerID != "" {
+            winner = fmt.Sprintf("winner <@%s> (%d points)", g.WinnerID, g.WinnerScore)
+        }
+        status := "in progress"
+        if !g.EndedAt.IsZero() {
+            status = fmt.Sprintf("%d questions", g.Questions)
+        }
+        response.WriteString(fmt.Sprintf("#%d <t:%d:d>: %s, %s\n", g.ID, g.StartedAt.Unix(), winner, status))
+    }
+    response.WriteString(b.prefixed(c.GuildID, "\nUse `!!trivia results <game id>` for a game's full scoreboard."))
 
-    s.ChannelMessageSend(m.ChannelID, response.String())
-    log.Printf("Scores requested by %s\n", m.Author.Username)
+    c.Send(response.String())
 }
 
-func (b *Bot) handleEnd(s *discordgo.Session, m *discordgo.MessageCreate) {
-    if !b.Trivia.Active {
-        s.ChannelMessageSendReply(m.ChannelID, "No active trivia game.", m.Reference())
+func (b *Bot) handleEnd(c *Context) {
+    t := b.Games.Get(c.GuildID, c.ChannelID)
+    if t == nil || t.End(endAdmin) != nil {
+        c.Reply("No active trivia game in this channel.")
         return
     }
 
-    b.Trivia.End()
-    s.ChannelMessageSend(m.ChannelID, "Trivia ended! Use `!!trivia scores` to see results.")
-    log.Printf("Trivia ended by %s\n", m.Author.Username)
+    c.Send(b.prefixed(c.GuildID, "Trivia ended! Use `!!trivia results` to see this game's results or `!!trivia scores` for all-time totals."))
+    log.Printf("Trivia ended by %s\n", c.Author.Username)
+}
+
+// ErrGameNotRunning is returned by EndGame for a game that isn't in progress.
+var ErrGameNotRunning = errors.New("game is not running")
+
+// RunningGames returns the recorded IDs of the games in progress.
+func (b *Bot) RunningGames() []int {
+    var ids []int
+    for _, t := range b.Games.Active("") {
+        if info, err := t.Info(); err == nil {
+            ids = append(ids, info.GameID)
+        }
+    }
+    return ids
+}
+
+// EndGame ends a running game by its recorded ID, as `!!trivia end` does in
+// its channel.
+func (b *Bot) EndGame(gameID int) error {
+    for _, t := range b.Games.Active("") {
+        if info, err := t.Info(); err != nil || info.GameID != gameID {
+            continue
+        }
+        if err := t.End(endAdmin); err != nil {
+            return err
+        }
+        b.Transport.ChannelMessageSend(t.ChannelID, b.prefixed(t.GuildID, "Trivia was ended by an admin. Use `!!trivia results` to see this game's results or `!!trivia scores` for all-time totals."))
+        return nil
+    }
+    return ErrGameNotRunning
 }
 
-func (b *Bot) handleHelp(s *discordgo.Session, m *discordgo.MessageCreate) {
+func (b *Bot) handleHelp(c *Context) {
     lines := []string{
         "**Trivia Bot Help**",
-        "Here are the available commands:",
+        "Here are the available commands. Every command also works as a slash command, e.g. `/trivia join`.",
         "\n **User Commands:**",
         "- **!!trivia help**: Show this help message.",
         "- **!!trivia join <team>**: Join a team (e.g., `!!trivia join Red`).",
-        "- **!!trivia answer <answer>**: Submit an answer to the current question (case-insensitive, e.g., `France` or `france`). Only the first correct answer earns points.",
-        "- **!!trivia scores**: Display individual and team scores.",
+        "- **!!trivia answer <answer>**: Submit an answer to the current question. Capitals, accents, punctuation, a leading \"the\" and small typos are forgiven, and numbers can be typed as digits or words. Only the first correct answer earns points. With `/trivia answer`, wrong answers are only shown to you.",
+        "- **!!trivia scores**: Display all-time individual and team scores.",
+        "- **!!trivia results [game id]**: Display the scoreboard of the latest (or given) game.",
+        "- **!!trivia profile [@user]**: Show your (or another player's) points, games played, wins, accuracy, fastest answer, longest streak, favorite category and team.",
+        "- **!!trivia badges [@user]**: Show the achievements you (or another player) have unlocked in this server.",
+        "- **!!trivia history**: List recent games with their winners.",
+        "- **!!trivia categories**: List question categories and how many questions each has.",
         "\n**Admin Commands (restricted to the bot's admin user):**",
-        "- **!!trivia start**: Start a new trivia contest.",
+        "- **!!trivia start [category=<name>] [difficulty=easy|medium|hard] [tag=<tag>]**: Start a new trivia contest, optionally limited to matching questions (e.g., `!!trivia start Old Testament` or `!!trivia start difficulty=easy`).",
+        "  Add `scoring=classic|speed|difficulty` to choose how points are awarded (speed: faster answers earn more, difficulty: harder questions earn more) and `partial=yes` to also reward the 2nd and 3rd correct answers.",
+        "  Add `timer=<seconds>` to reveal the answer when time runs out, `intermission=<seconds>` to post the next question automatically, and `questions=<count>` to end after that many questions (e.g., `!!trivia start timer=30 intermission=10 questions=20`).",
         "- **!!trivia end**: End the current trivia contest.",
         "- **!!trivia next**: Trigger the next question.",
-        "- **!!trivia reset**: Reset all scores and teams, preserving questions.",
+        "- **!!trivia reset**: Reset this server's all-time scores and teams, preserving questions and game history.",
         "- **!!trivia list**: Post how many questiosn are in the database.",
         "- **!!trivia list questions**: Post all the questions in the database, without answers.",
         "- **!!trivia list answers**: Post all the questions in the database, with answers.",
         "- **!!trivia addq <question> | <answer>**: Add a new question (e.g., `!!trivia addq What is 2+2? | 4`).",
+        "- **!!trivia addq <question> | <answer> | <wrong> [| <wrong> | <wrong>]**: Add a multiple-choice question answered with buttons (e.g., `!!trivia addq What is 2+2? | 4 | 3 | 5 | 22`).",
+        "  Add `| aliases=<alias>; <alias>` to accept other answers, or `| exact=yes` to turn off typo forgiveness (e.g., `!!trivia addq Longest river? | Nile | aliases=Nile River`).",
+        "  Add `| category=<name>`, `| tags=<tag>, <tag>` and `| difficulty=easy|medium|hard` to organize questions (difficulty defaults to medium).",
         "- **!!trivia removeq <id>**: Remove a question by ID.",
+        "- **!!trivia qstats <id>**: Show a question's attempts, correct rate, median answer time and most common wrong answers.",
+        "- **!!trivia calibrate [minimum attempts]**: Suggest new difficulties for questions answered correctly much more or less often than their rating suggests (questions need 10 attempts by default).",
+        "- **!!trivia achievement [list|add <name> | <description> | <metric>=<threshold>|remove <key>]**: Show or change the achievements players can unlock (e.g., `!!trivia achievement add Sharpshooter | Answer 50 questions correctly | correct=50`). `list` shows the metrics. Only the bot's admins can add or remove achievements, since every server shares them.",
+        "- **!!trivia export [json|csv]**: Download the whole question bank as a file.",
+        "- **!!trivia config [list|get <setting>|set <setting> <value>|reset <setting>]**: Show or change this server's settings: command prefix, allowed channels, admin roles, points, idle timeout, default question timer and intermission, default category and question cooldown (e.g., `!!trivia config set points 20`). Works in any channel.",
+        "- **!!trivia import**: Attach a JSON or CSV file to preview an import with a per-row validation report, then use `!!trivia import confirm` to save it or `!!trivia import cancel` to discard it.",
+        "- **!!trivia dashboard**: Get a one-time login link for the question bank web dashboard by direct message.",
     }
-    helpMessage := strings.Join(lines, "\n")
-
-    s.ChannelMessageSendReply(m.ChannelID, helpMessage, m.Reference())
+    c.Reply(b.prefixed(c.GuildID, strings.Join(lines, "\n")))
 }
 
-func (b *Bot) handleNext(s *discordgo.Session, m *discordgo.MessageCreate) {
-    if !b.Trivia.Active {
-        s.ChannelMessageSendReply(m.ChannelID, "No active trivia game. Use `!!trivia start` to begin.", m.Reference())
-        return
+// prefixed rewrites the commands in text to use the guild's prefix.
+func (b *Bot) prefixed(guildID, text string) string {
+    if prefix := b.guildSettings(guildID).Prefix; prefix != commandPrefix {
+        return strings.ReplaceAll(text, commandPrefix+" ", prefix+" ")
     }
+    return text
+}
 
-    // Signal the next question
-    select {
-    case b.Trivia.NextChan <- struct{}{}:
-        // Success, question will be posted by runTrivia
-    default:
-        s.ChannelMessageSendReply(m.ChannelID, "A question is already being posted. Please wait.", m.Reference())
+func (b *Bot) handleNext(c *Context) {
+    t := b.Games.Get(c.GuildID, c.ChannelID)
+    if t == nil || t.Next() != nil {
+        c.Reply(b.prefixed(c.GuildID, "No active trivia game in this channel. Use `!!trivia start` to begin."))
+        return
     }
-    log.Printf("Next question requested by %s\n", m.Author.Username)
+    log.Printf("Next question requested by %s\n", c.Author.Username)
 }
 
-func (b *Bot) handleReset(s *discordgo.Session, m *discordgo.MessageCreate) {
-    if err := b.DB.ResetScoresAndTeams(); err != nil {
-        s.ChannelMessageSendReply(m.ChannelID, "Error resetting scores and teams.", m.Reference())
+func (b *Bot) handleReset(c *Context) {
+    if err := b.DB.ResetScoresAndTeams(c.GuildID); err != nil {
+        c.Reply("Error resetting scores and teams.")
         log.Printf("Reset error: %v", err)
         return
     }
 
-    // End any active trivia game
-    if b.Trivia.Active {
-        b.Trivia.End()
-        s.ChannelMessageSend(m.ChannelID, "Trivia game ended.")
+    // End any active trivia games in this server
+    for _, t := range b.Games.Active(c.GuildID) {
+        if t.End(endReset) == nil {
+            c.Transport.ChannelMessageSend(t.ChannelID, "Trivia game ended.")
+        }
     }
 
-    s.ChannelMessageSend(m.ChannelID, "Scores and teams reset successfully. Questions preserved.")
-    log.Printf("Scores and teams reset by %s\n", m.Author.Username)
+    c.Send("Scores and teams reset successfully. Questions preserved.")
+    log.Printf("Scores and teams reset by %s\n", c.Author.Username)
 }
 
-func (b *Bot) handleListQuestions(s *discordgo.Session, m *discordgo.MessageCreate, answerSwitch string) {
+func (b *Bot) handleListQuestions(c *Context) {
     includeAnswer := false
+    answerSwitch := c.Args
+    if answerSwitch == "" {
+        answerSwitch = "count"
+    }
 
     switch answerSwitch {
     case "questions":
@@ -266,22 +646,25 @@ func (b *Bot) handleListQuestions(s *discordgo.Session, m *discordgo.MessageCrea
         includeAnswer = true
     case "count":
         includeAnswer = false
+    default:
+        c.Reply(b.prefixed(c.GuildID, "Usage: `!!trivia list [questions|answers]`"))
+        return
     }
         
     questions, err := b.DB.ListQuestions()
     if err != nil {
-        s.ChannelMessageSendReply(m.ChannelID, "Error fetching questions.", m.Reference())
+        c.Reply("Error fetching questions.")
         log.Printf("List questions error: %v", err)
         return
     }
 
     if len(questions) == 0 {
-        s.ChannelMessageSendReply(m.ChannelID, "No questions in the database.", m.Reference())
+        c.Reply("No questions in the database.")
         return
     }
 
     if answerSwitch == "count" {
-        s.ChannelMessageSendReply(m.ChannelID, fmt.Sprintf("There are %d questions in the database.", len(questions)), m.Reference())
+        c.Reply(fmt.Sprintf("There are %d questions in the database.", len(questions)))
         return
     }
 
@@ -291,9 +674,21 @@ func (b *Bot) handleListQuestions(s *discordgo.Session, m *discordgo.MessageCrea
         if !includeAnswer {
             q.Answer = "REDACTED"
         }
-        line := fmt.Sprintf("ID: %d\nQuestion: %s\nAnswer: ||%s||\n\n", q.ID, q.Text, q.Answer)
+        line := fmt.Sprintf("ID: %d\nQuestion: %s\nAnswer: ||%s||\n", q.ID, q.Text, q.Answer)
+        line += fmt.Sprintf("Category: %s | Difficulty: %s", valueOr(q.Category, "none"), db.DifficultyName(q.Difficulty))
+        if len(q.Tags) > 0 {
+            line += " | Tags: " + strings.Join(q.Tags, ", ")
+        }
+        line += "\n"
+        if q.IsChoice() && includeAnswer {
+            line += fmt.Sprintf("Wrong answers: ||%s||\n", strings.Join(q.Distractors, ", "))
+        }
+        if len(q.Aliases) > 0 && includeAnswer {
+            line += fmt.Sprintf("Also accepted: ||%s||\n", strings.Join(q.Aliases, "; "))
+        }
+        line += "\n"
         if response.Len()+len(line) > 1900 { // Reserve space for Discord's 2000-char limit
-            s.ChannelMessageSend(m.ChannelID, response.String())
+            c.Send(response.String())
             response.Reset()
             response.WriteString("**Question List (continued)**\n\n")
         }
@@ -301,8 +696,38 @@ func (b *Bot) handleListQuestions(s *discordgo.Session, m *discordgo.MessageCrea
     }
 
     if response.Len() > 0 {
-        s.ChannelMessageSendReply(m.ChannelID, response.String(), m.Reference())
+        c.Reply(response.String())
     }
 
-    log.Printf("Questions listed by %s\n", m.Author.Username)
+    log.Printf("Questions listed by %s\n", c.Author.Username)
+}
+
+// valueOr returns value, or fallback when value is empty.
+func valueOr(value, fallback string) string {
+    if value == "" {
+        return fallback
+    }
+    return value
+}
+
+func (b *Bot) handleCategories(c *Context) {
+    categories, err := b.DB.ListCategories()
+    if err != nil {
+        c.Reply("Error fetching categories.")
+        log.Printf("List categories error: %v", err)
+        return
+    }
+
+    if len(categories) == 0 {
+        c.Reply("No questions in the database.")
+        return
+    }
+
+    var response strings.Builder
+    response.WriteString("**Categories**\n")
+    for _, category := range categories {
+        response.WriteString(fmt.Sprintf("%s: %d questions\n", valueOr(category.Category, "(none)"), category.Count))
+    }
+    response.WriteString(b.prefixed(c.GuildID, "\nStart a round with `!!trivia start category=<name>`."))
+    c.Reply(response.String())
 }
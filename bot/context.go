@@ -0,0 +1,176 @@
+package bot
+
+import (
+    "io"
+    "log"
+    "strings"
+    "sync"
+
+    "github.com/airylvat/trivia-bot/metrics"
+
+    "github.com/bwmarrin/discordgo"
+)
+
+// Context carries a single command invocation, whether it arrived as a
+// `!!trivia` message or a `/trivia` slash command, and replies on the
+// matching path.
+type Context struct {
+    Transport   Transport
+    GuildID     string
+    ChannelID   string
+    Author      *discordgo.User
+    Member      *discordgo.Member
+    Args        string // Everything after the command name, e.g. the team in `!!trivia join red`
+    Attachments []*discordgo.MessageAttachment
+
+    Message     *discordgo.MessageCreate     // Set for prefix commands
+    Interaction *discordgo.InteractionCreate // Set for slash commands
+
+    responded bool
+    failed    bool // Replied with an error
+    mutex     sync.Mutex
+}
+
+func newMessageContext(tr Transport, m *discordgo.MessageCreate, args string) *Context {
+    return &Context{
+        Transport:   tr,
+        GuildID:     m.GuildID,
+        ChannelID:   m.ChannelID,
+        Author:      m.Author,
+        Member:      m.Member,
+        Args:        args,
+        Attachments: m.Attachments,
+        Message:     m,
+    }
+}
+
+func newInteractionContext(tr Transport, i *discordgo.InteractionCreate, args string) *Context {
+    c := &Context{
+        Transport:   tr,
+        GuildID:     i.GuildID,
+        ChannelID:   i.ChannelID,
+        Member:      i.Member,
+        Args:        args,
+        Interaction: i,
+    }
+    if i.Member != nil {
+        c.Author = i.Member.User
+    } else {
+        c.Author = i.User
+    }
+    return c
+}
+
+// Reply answers the invoking message, or the interaction for slash commands.
+func (c *Context) Reply(content string) {
+    c.note(content)
+    if c.Interaction != nil {
+        c.respond(content, 0)
+        return
+    }
+    c.Transport.ChannelMessageSendReply(c.ChannelID, content, c.Message.Reference())
+}
+
+// ReplyPrivate answers so that only the invoking user sees it. Prefix
+// commands cannot be private, so they fall back to a normal reply.
+func (c *Context) ReplyPrivate(content string) {
+    c.note(content)
+    if c.Interaction != nil {
+        c.respond(content, discordgo.MessageFlagsEphemeral)
+        return
+    }
+    c.Reply(content)
+}
+
+// Send posts a plain message to the channel. Slash commands must answer the
+// interaction itself, so the first Send is used as the interaction response.
+func (c *Context) Send(content string) {
+    c.note(content)
+    if c.Interaction != nil {
+        c.mutex.Lock()
+        responded := c.responded
+        c.mutex.Unlock()
+        if !responded {
+            c.respond(content, 0)
+            return
+        }
+    }
+    c.Transport.ChannelMessageSend(c.ChannelID, content)
+}
+
+// ReplyFile answers with a file attachment.
+func (c *Context) ReplyFile(content, name string, r io.Reader) {
+    file := &discordgo.File{Name: name, Reader: r}
+    if c.Interaction != nil {
+        c.respond(content, 0, file)
+        return
+    }
+    c.Transport.ChannelMessageSendComplex(c.ChannelID, &discordgo.MessageSend{
+        Content:   content,
+        Files:     []*discordgo.File{file},
+        Reference: c.Message.Reference(),
+    })
+}
+
+// note marks the command as failed when it replies with an error. Error
+// replies start with "Error" by convention.
+func (c *Context) note(content string) {
+    if strings.HasPrefix(content, "Error") {
+        c.mutex.Lock()
+        c.failed = true
+        c.mutex.Unlock()
+    }
+}
+
+// outcome is the command's result for metrics.
+func (c *Context) outcome() string {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+    if c.failed {
+        return metrics.OutcomeError
+    }
+    return metrics.OutcomeOK
+}
+
+// respond answers the interaction, using a follow-up message once the
+// initial response has been sent.
+func (c *Context) respond(content string, flags discordgo.MessageFlags, files ...*discordgo.File) {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    var err error
+    if !c.responded {
+        err = c.Transport.InteractionRespond(c.Interaction.Interaction, &discordgo.InteractionResponse{
+            Type: discordgo.InteractionResponseChannelMessageWithSource,
+            Data: &discordgo.InteractionResponseData{
+                Content: content,
+                Flags:   flags,
+                Files:   files,
+            },
+        })
+        c.responded = true
+    } else {
+        _, err = c.Transport.FollowupMessageCreate(c.Interaction.Interaction, true, &discordgo.WebhookParams{
+            Content: content,
+            Flags:   flags,
+            Files:   files,
+        })
+    }
+    if err != nil {
+        log.Printf("Interaction response error: %v", err)
+    }
+}
+
+// finish acknowledges a slash command whose handler sent nothing, so Discord
+// doesn't show "The application did not respond".
+func (c *Context) finish() {
+    if c.Interaction == nil {
+        return
+    }
+    c.mutex.Lock()
+    responded := c.responded
+    c.mutex.Unlock()
+    if !responded {
+        c.respond("Done.", discordgo.MessageFlagsEphemeral)
+    }
+}
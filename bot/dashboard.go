@@ -0,0 +1,39 @@
+package bot
+
+import (
+    "fmt"
+    "log"
+    "time"
+)
+
+// Dashboard issues login links for the web dashboard.
+type Dashboard interface {
+    LoginURL(userID string) (url string, expires time.Time, err error)
+}
+
+// handleDashboard sends the admin a one-time dashboard login link by direct
+// message, so the link never appears in a channel.
+func (b *Bot) handleDashboard(c *Context) {
+    if b.Dashboard == nil {
+        c.ReplyPrivate("The dashboard is not enabled. Set API_ADDRESS to turn it on.")
+        return
+    }
+
+    url, expires, err := b.Dashboard.LoginURL(c.Author.ID)
+    if err != nil {
+        c.ReplyPrivate("Error creating a login link.")
+        log.Printf("Dashboard login error: %v", err)
+        return
+    }
+
+    channel, err := c.Transport.UserChannelCreate(c.Author.ID)
+    if err == nil {
+        _, err = c.Transport.ChannelMessageSend(channel.ID, fmt.Sprintf("Here is your question bank dashboard login link. It works once and expires <t:%d:R>:\n<%s>", expires.Unix(), url))
+    }
+    if err != nil {
+        c.ReplyPrivate("Error sending you a direct message. Check that you allow direct messages from server members.")
+        log.Printf("Dashboard DM error: %v", err)
+        return
+    }
+    c.ReplyPrivate("I sent you a login link by direct message.")
+}
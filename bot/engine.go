@@ -0,0 +1,454 @@
+package bot
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "log"
+    "time"
+
+    "github.com/airylvat/trivia-bot/db"
+    "github.com/airylvat/trivia-bot/metrics"
+)
+
+// commandKind is something a handler asks a running game to do.
+type commandKind int
+
+const (
+    cmdNext   commandKind = iota // Close the open question and post the next
+    cmdAnswer                    // A typed answer
+    cmdPick                      // A multiple-choice button click
+    cmdEnd                       // End the game
+    cmdPause                     // Save the game and stop so the bot can restart
+    cmdInfo                      // Report the game's ID and status
+)
+
+// gameCommand is sent to the goroutine that owns a game. Answers and picks
+// carry the player's command so the game can reply to it.
+type gameCommand struct {
+    kind       commandKind
+    ctx        *Context
+    questionID int    // For cmdPick
+    option     int    // For cmdPick
+    reason     string // For cmdEnd
+    reply      chan gameInfo
+}
+
+// gameInfo is a game's ID and status, as seen by the last command.
+type gameInfo struct {
+    GameID int
+    Status gameStatus
+}
+
+// send hands a command to the game and waits until it has been handled. It
+// returns ErrGameNotRunning if the game has stopped.
+func (t *Trivia) send(cmd gameCommand) (gameInfo, error) {
+    return t.sendContext(context.Background(), cmd)
+}
+
+// sendContext is send, giving up with ctx's error when ctx ends first.
+func (t *Trivia) sendContext(ctx context.Context, cmd gameCommand) (gameInfo, error) {
+    cmd.reply = make(chan gameInfo, 1)
+    select {
+    case t.commands <- cmd:
+    case <-t.done:
+        return gameInfo{}, ErrGameNotRunning
+    case <-ctx.Done():
+        return gameInfo{}, ctx.Err()
+    }
+    select {
+    case info := <-cmd.reply:
+        return info, nil
+    case <-ctx.Done():
+        return gameInfo{}, ctx.Err()
+    }
+}
+
+// Next closes the open question and posts the next one.
+func (t *Trivia) Next() error {
+    _, err := t.send(gameCommand{kind: cmdNext})
+    return err
+}
+
+// Answer submits the command's arguments as an answer to the open question.
+// The game replies to the command.
+func (t *Trivia) Answer(c *Context) error {
+    _, err := t.send(gameCommand{kind: cmdAnswer, ctx: c})
+    return err
+}
+
+// Pick submits a multiple-choice button click. The game replies to it.
+func (t *Trivia) Pick(c *Context, questionID, option int) error {
+    _, err := t.send(gameCommand{kind: cmdPick, ctx: c, questionID: questionID, option: option})
+    return err
+}
+
+// End ends the game, recording the reason in its history.
+func (t *Trivia) End(reason string) error {
+    _, err := t.send(gameCommand{kind: cmdEnd, reason: reason})
+    return err
+}
+
+// Pause saves the game and stops it so it can resume after a restart.
+func (t *Trivia) Pause() error {
+    return t.PauseContext(context.Background())
+}
+
+// PauseContext is Pause, giving up when ctx ends.
+func (t *Trivia) PauseContext(ctx context.Context) error {
+    _, err := t.sendContext(ctx, gameCommand{kind: cmdPause})
+    return err
+}
+
+// Info returns the game's ID and status.
+func (t *Trivia) Info() (gameInfo, error) {
+    return t.send(gameCommand{kind: cmdInfo})
+}
+
+// runTrivia owns a game from the moment it starts until it ends or pauses,
+// handling commands and timers one at a time.
+func (b *Bot) runTrivia(t *Trivia) {
+    defer b.releaseGame(t)
+
+    idle := time.NewTimer(t.IdleTimeout)
+    defer idle.Stop()
+
+    // A resumed game picks up where it was saved
+    switch t.Status {
+    case statusOpen:
+        if err := b.postQuestion(t); err != nil {
+            b.Transport.ChannelMessageSend(t.ChannelID, "Error posting question. Ending trivia.")
+            log.Printf("Embed error: %v", err)
+            b.endGame(t, endError)
+            return
+        }
+        b.saveGame(t)
+        if !t.Deadline.IsZero() {
+            t.questionTimer = time.After(time.Until(t.Deadline))
+        }
+    case statusClosed:
+        b.questionClosed(t)
+    }
+
+    for t.running() {
+        select {
+        case cmd := <-t.commands:
+            b.runCommand(t, cmd)
+            cmd.reply <- gameInfo{GameID: t.GameID, Status: t.Status}
+            if cmd.kind == cmdInfo {
+                continue // Lookups from the API aren't activity, so they don't keep the game alive
+            }
+        case <-t.advanceTimer:
+            b.nextQuestion(t)
+        case <-t.questionTimer:
+            b.closeQuestion(t, true)
+            b.questionClosed(t)
+        case <-idle.C:
+            b.Transport.ChannelMessageSend(t.ChannelID, "Trivia timed out due to inactivity. Ending game.")
+            b.endGame(t, endTimeout)
+        }
+        idle.Reset(t.IdleTimeout)
+    }
+}
+
+// releaseGame unregisters a game whose goroutine has stopped, or that never
+// got one, and fails any commands still waiting for it.
+func (b *Bot) releaseGame(t *Trivia) {
+    b.Games.remove(t)
+    close(t.done)
+}
+
+func (b *Bot) runCommand(t *Trivia, cmd gameCommand) {
+    switch cmd.kind {
+    case cmdNext:
+        b.nextQuestion(t)
+    case cmdAnswer:
+        b.answerQuestion(t, cmd.ctx)
+    case cmdPick:
+        b.pickOption(t, cmd.ctx, cmd.questionID, cmd.option)
+    case cmdEnd:
+        b.endGame(t, cmd.reason)
+    case cmdPause:
+        b.pauseGame(t)
+    case cmdInfo:
+    }
+}
+
+// nextQuestion closes the open question and posts the next one, or ends the
+// game if it has asked all its questions.
+func (b *Bot) nextQuestion(t *Trivia) {
+    t.advanceTimer = nil
+    b.closeQuestion(t, false)
+    if t.finished() {
+        b.endGame(t, endFinished)
+        b.Transport.ChannelMessageSend(t.ChannelID, b.prefixed(t.GuildID, "That was the last question! Trivia ended. Use `!!trivia results` to see this game's results."))
+        return
+    }
+
+    q, err := b.DB.GetRandomQuestion(t.Filter, b.exclusion(t))
+    if errors.Is(err, sql.ErrNoRows) {
+        b.outOfQuestions(t)
+        return
+    }
+    if err != nil {
+        b.Transport.ChannelMessageSend(t.ChannelID, "Error fetching question. Ending trivia.")
+        log.Printf("Question fetch error: %v", err)
+        b.endGame(t, endError)
+        return
+    }
+
+    if err := t.setQuestion(q); err != nil {
+        log.Printf("Error opening question: %v", err)
+        return
+    }
+    if err := b.DB.RecordAskedQuestion(t.GuildID, t.GameID, q.ID); err != nil {
+        log.Printf("Error recording question %d in game %d: %v", q.ID, t.GameID, err)
+    }
+    if err := b.postQuestion(t); err != nil {
+        b.Transport.ChannelMessageSend(t.ChannelID, "Error posting question. Ending trivia.")
+        log.Printf("Embed error: %v", err)
+        b.endGame(t, endError)
+        return
+    }
+    b.saveGame(t)
+
+    if t.QuestionTime > 0 {
+        t.questionTimer = time.After(t.QuestionTime)
+    }
+}
+
+// exclusion rules out the questions the game has asked and, with the
+// guild's question_cooldown, those asked recently in the guild.
+func (b *Bot) exclusion(t *Trivia) db.Exclusion {
+    settings := b.guildSettings(t.GuildID)
+    exclude := db.Exclusion{GuildID: t.GuildID, GameID: t.GameID, Games: settings.CooldownGames}
+    if settings.CooldownDays > 0 {
+        exclude.Since = time.Now().AddDate(0, 0, -settings.CooldownDays)
+    }
+    return exclude
+}
+
+// outOfQuestions ends a game that has no question left to ask, saying
+// whether none match it at all or every match has been used.
+func (b *Bot) outOfQuestions(t *Trivia) {
+    _, err := b.DB.GetRandomQuestion(t.Filter, db.Exclusion{})
+    switch {
+    case errors.Is(err, sql.ErrNoRows):
+        b.Transport.ChannelMessageSend(t.ChannelID, "No questions match this game. Ending trivia.")
+        b.endGame(t, endNoQuestions)
+    case err != nil:
+        b.Transport.ChannelMessageSend(t.ChannelID, "Error fetching question. Ending trivia.")
+        log.Printf("Question fetch error: %v", err)
+        b.endGame(t, endError)
+    case t.Asked == 0:
+        b.Transport.ChannelMessageSend(t.ChannelID, b.prefixed(t.GuildID, "Every question matching this game was asked recently in this server. Ending trivia. Admins can change this with `!!trivia config set question_cooldown`."))
+        b.endGame(t, endExhausted)
+    default:
+        b.endGame(t, endExhausted)
+        b.Transport.ChannelMessageSend(t.ChannelID, b.prefixed(t.GuildID, "That's every question this game can ask! Trivia ended. Use `!!trivia results` to see this game's results."))
+    }
+}
+
+// questionClosed ends the game after its last question, or schedules the
+// next one when the game advances on its own.
+func (b *Bot) questionClosed(t *Trivia) {
+    if t.finished() {
+        b.endGame(t, endFinished)
+        b.Transport.ChannelMessageSend(t.ChannelID, b.prefixed(t.GuildID, "That was the last question! Trivia ended. Use `!!trivia results` to see this game's results."))
+        return
+    }
+    if t.Intermission > 0 {
+        t.advanceTimer = time.After(t.Intermission)
+        b.Transport.ChannelMessageSend(t.ChannelID, fmt.Sprintf("Next question in %d seconds...", int(t.Intermission.Seconds())))
+    }
+}
+
+// closeQuestion stops accepting answers for the open question. Multiple
+// choice results are always revealed; with timeUp set, an unanswered typed
+// question has its answer revealed too.
+func (b *Bot) closeQuestion(t *Trivia, timeUp bool) {
+    result, err := t.closeQuestion()
+    if err != nil {
+        log.Printf("Error closing question: %v", err)
+    }
+    if result == nil {
+        return
+    }
+    b.saveGame(t)
+
+    if result.Tally != nil {
+        b.revealChoices(t, result, timeUp)
+        // Picks stay secret until now, so their achievements wait too
+        for _, award := range result.Awards {
+            b.checkAchievements(t, award.UserID, 0)
+        }
+        return
+    }
+    if timeUp && !result.AnsweredCorrect {
+        b.Transport.ChannelMessageSend(t.ChannelID, fmt.Sprintf("Time's up! The answer to question # %d was **%s**.", result.Question.ID, result.Question.Answer))
+    }
+}
+
+// Reasons a game ended, recorded in its history
+const (
+    endAdmin       = "admin"
+    endFinished    = "finished"
+    endTimeout     = "timeout"
+    endNoQuestions = "no questions"
+    endExhausted   = "out of questions" // Every matching question was already used
+    endReset       = "reset"
+    endError       = "error"
+)
+
+// endGame closes the open question, ends the game and records why.
+func (b *Bot) endGame(t *Trivia, reason string) {
+    b.closeQuestion(t, false)
+    if err := t.transition(statusEnded); err != nil {
+        log.Printf("Error ending game: %v", err)
+        return
+    }
+    metrics.GamesEnded.WithLabelValues(reason).Inc()
+
+    if err := b.DB.EndGame(t.GameID, reason, t.Asked); err != nil {
+        log.Printf("Error recording end of game %d: %v", t.GameID, err)
+    }
+    if err := b.DB.DeleteGameState(t.GameID); err != nil {
+        log.Printf("Error deleting state of game %d: %v", t.GameID, err)
+    }
+    b.checkGameAchievements(t)
+}
+
+// pauseGame saves the game and stops it without recording an end, so its
+// players keep their scores and it can continue after the restart.
+func (b *Bot) pauseGame(t *Trivia) {
+    b.saveGame(t)
+    if err := t.transition(statusPaused); err != nil {
+        log.Printf("Error pausing game: %v", err)
+        return
+    }
+
+    if _, err := b.Transport.ChannelMessageSend(t.ChannelID, "Trivia is pausing while the bot restarts. This game's progress and scores have been saved, and it will resume when the bot is back."); err != nil {
+        log.Printf("Error announcing pause of game %d: %v", t.GameID, err)
+    }
+    log.Printf("Paused game %d in channel %s", t.GameID, t.ChannelID)
+}
+
+// answerQuestion checks a typed answer to the open question and replies to
+// the player.
+func (b *Bot) answerQuestion(t *Trivia, c *Context) {
+    err := t.checkOpen()
+    if err == nil && t.Current.IsChoice() {
+        err = errChoiceQuestion
+    }
+    switch {
+    case errors.Is(err, errNoQuestion):
+        c.Reply("No active trivia question in this channel.")
+        return
+    case errors.Is(err, errChoiceQuestion):
+        c.ReplyPrivate("This is a multiple-choice question. Use the buttons under the question to answer.")
+        return
+    case errors.Is(err, errAlreadyAnswered):
+        c.ReplyPrivate("This question has already been answered correctly. Wait for the next question.")
+        return
+    case err != nil:
+        c.ReplyPrivate("Time's up for this question. Wait for the next question.")
+        return
+    }
+
+    team, err := b.DB.GetPlayerTeam(c.GuildID, c.Author.ID)
+    if err != nil {
+        c.ReplyPrivate(b.prefixed(c.GuildID, "You must join a team first with `!!trivia join <team>`."))
+        return
+    }
+
+    q := t.Current
+    log.Printf("Comparing answer: user=%q, correct=%q, team=%q", c.Args, q.Answer, team)
+    if !b.Matcher.Match(c.Args, q.AcceptedAnswers(), q.ExactOnly) {
+        countAnswer(false, nil)
+        b.recordAttempt(t, c.Author.ID, c.Args, false)
+        c.ReplyPrivate("Incorrect answer.")
+        return
+    }
+
+    award, ok := t.award(c.Author.ID)
+    countAnswer(true, &award) // An award with no rank when it didn't score
+    b.recordAttempt(t, c.Author.ID, c.Args, true)
+    if !ok {
+        c.ReplyPrivate("This question has already been answered correctly, or you already scored on it. Wait for the next question.")
+        return
+    }
+
+    // The question closes once it has all the correct answers that can score
+    closing := len(t.Awards) >= t.maxAwards()
+    if err := b.DB.AddScore(c.GuildID, t.GameID, c.Author.ID, team, award.Points); err != nil {
+        c.Reply("Error updating score.")
+        log.Printf("Score update error: %v", err)
+    } else {
+        status := fmt.Sprintf("Still open for %d more correct answers.", t.maxAwards()-award.Rank)
+        if closing {
+            status = b.prefixed(t.GuildID, "Question closed, admin use `!!trivia next` for the next question.")
+            if t.Intermission > 0 {
+                status = "Question closed, the next question is coming up."
+            }
+        }
+        c.Reply(fmt.Sprintf("%s answered correctly %sfor team %s! +%d points! %s", c.Author.Username, rankLabel(award.Rank), team, award.Points, status))
+        b.checkAchievements(t, c.Author.ID, 0)
+    }
+
+    if closing {
+        b.closeQuestion(t, false)
+        b.questionClosed(t)
+    } else {
+        b.saveGame(t)
+    }
+}
+
+// recordAttempt stores an answer to the open question for its statistics.
+func (b *Bot) recordAttempt(t *Trivia, userID, answer string, correct bool) {
+    a := &db.Attempt{
+        GameID:     t.GameID,
+        GuildID:    t.GuildID,
+        QuestionID: t.Current.ID,
+        UserID:     userID,
+        Answer:     answer,
+        Correct:    correct,
+        Latency:    time.Since(t.StartTime),
+    }
+    if err := b.DB.RecordAttempt(a); err != nil {
+        log.Printf("Error recording answer to question %d: %v", a.QuestionID, err)
+    }
+}
+
+// pickOption records a multiple-choice button click and replies privately.
+func (b *Bot) pickOption(t *Trivia, c *Context, questionID, option int) {
+    team, err := b.DB.GetPlayerTeam(c.GuildID, c.Author.ID)
+    if err != nil {
+        c.ReplyPrivate(b.prefixed(c.GuildID, "You must join a team first with `!!trivia join <team>`."))
+        return
+    }
+
+    correct, award, err := t.recordPick(questionID, c.Author.ID, option)
+    if errors.Is(err, errAlreadyPicked) {
+        c.ReplyPrivate("Your first pick is already locked in.")
+        return
+    }
+    if err != nil {
+        c.ReplyPrivate("This question is closed.")
+        return
+    }
+    countAnswer(correct, award)
+    b.recordAttempt(t, c.Author.ID, t.Options[option], correct)
+    b.saveGame(t)
+
+    if award != nil {
+        if err := b.DB.AddScore(c.GuildID, t.GameID, c.Author.ID, team, award.Points); err != nil {
+            c.ReplyPrivate("Error updating score.")
+            log.Printf("Score update error: %v", err)
+            return
+        }
+        log.Printf("User %s picked the correct answer for team %s (rank %d, %d points)", c.Author.Username, team, award.Rank, award.Points)
+    }
+
+    c.ReplyPrivate(fmt.Sprintf("You picked %c. Your answer is locked in; results are revealed when the question closes.", choiceLetters[option]))
+}
@@ -0,0 +1,201 @@
+package bot
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+    "sync"
+    "testing"
+
+    "github.com/airylvat/trivia-bot/config"
+    "github.com/airylvat/trivia-bot/db"
+
+    "github.com/bwmarrin/discordgo"
+)
+
+func TestTransitions(t *testing.T) {
+    tests := []struct {
+        from, to gameStatus
+        ok       bool
+    }{
+        {statusLobby, statusOpen, true},
+        {statusLobby, statusClosed, false},
+        {statusOpen, statusClosed, true},
+        {statusOpen, statusOpen, false},
+        {statusOpen, statusLobby, false},
+        {statusClosed, statusOpen, true},
+        {statusClosed, statusEnded, true},
+        {statusPaused, statusOpen, false},
+        {statusEnded, statusOpen, false},
+        {statusEnded, statusEnded, false},
+    }
+    for _, test := range tests {
+        game := NewTrivia(testGuild, testChannel)
+        game.Status = test.from
+        err := game.transition(test.to)
+        if test.ok && err != nil {
+            t.Errorf("%s to %s: %v", test.from, test.to, err)
+        }
+        if !test.ok && err == nil {
+            t.Errorf("%s to %s was allowed", test.from, test.to)
+        }
+        if !test.ok && game.Status != test.from {
+            t.Errorf("refused %s to %s still changed the status to %s", test.from, test.to, game.Status)
+        }
+    }
+}
+
+func TestEndedGameRejectsCommands(t *testing.T) {
+    b, fake := newTestBot(t, &db.Question{Text: "Q?", Answer: "a", Kind: db.KindText})
+    send(b, testAdmin, "!!trivia start")
+    postedQuestion(t, b, fake)
+
+    game := b.Games.Get(testGuild, testChannel)
+    if err := game.End(endAdmin); err != nil {
+        t.Fatalf("ending: %v", err)
+    }
+    for name, err := range map[string]error{
+        "next":  game.Next(),
+        "end":   game.End(endAdmin),
+        "pause": game.Pause(),
+    } {
+        if !errors.Is(err, ErrGameNotRunning) {
+            t.Errorf("%s after the end returned %v, want ErrGameNotRunning", name, err)
+        }
+    }
+}
+
+// TestAnswerStorm sends answers, next and end at one game from many
+// goroutines at once. Run it with -race.
+func TestAnswerStorm(t *testing.T) {
+    const players, answers, questions = 8, 25, 30
+
+    var bank []*db.Question
+    for i := 0; i < questions; i++ {
+        bank = append(bank, &db.Question{Text: fmt.Sprintf("Question %d?", i), Answer: "yes", Kind: db.KindText})
+    }
+    b, fake := newTestBot(t, bank...)
+
+    var playerIDs []string
+    for i := 0; i < players; i++ {
+        id := fmt.Sprintf("2000000000000000%02d", i)
+        playerIDs = append(playerIDs, id)
+        send(b, id, "!!trivia join team"+fmt.Sprint(i%2))
+    }
+    send(b, testAdmin, "!!trivia start")
+    postedQuestion(t, b, fake)
+
+    var wg sync.WaitGroup
+    for _, id := range playerIDs {
+        wg.Add(1)
+        go func(id string) {
+            defer wg.Done()
+            for i := 0; i < answers; i++ {
+                answer := "yes"
+                if i%3 == 0 {
+                    answer = "no"
+                }
+                send(b, id, "!!trivia answer "+answer)
+            }
+        }(id)
+    }
+    wg.Add(2)
+    go func() {
+        defer wg.Done()
+        for i := 0; i < questions/2; i++ {
+            send(b, testAdmin, "!!trivia next")
+        }
+    }()
+    go func() {
+        defer wg.Done()
+        for i := 0; i < 20; i++ {
+            b.RunningGames()
+        }
+    }()
+    wg.Wait()
+
+    send(b, testAdmin, "!!trivia end")
+    expect(t, fake, "Trivia ended!")
+    send(b, testAdmin, "!!trivia next")
+    expect(t, fake, "No active trivia game in this channel.")
+
+    // Classic scoring awards one correct answer per question
+    correct, posted := 0, 0
+    for _, m := range fake.Messages() {
+        if strings.Contains(m.Content, " answered correctly ") {
+            correct++
+        }
+        if len(m.Embeds) > 0 && strings.HasPrefix(m.Embeds[0].Title, "Trivia Question # ") {
+            posted++
+        }
+    }
+    if correct == 0 || correct > posted {
+        t.Errorf("%d correct answers scored on %d questions", correct, posted)
+    }
+
+    scorers, _, err := b.DB.GetGameScores(1)
+    if err != nil {
+        t.Fatalf("game scores: %v", err)
+    }
+    total := 0
+    for _, p := range scorers {
+        total += p.Score
+    }
+    if total != correct*basePoints {
+        t.Errorf("players scored %d points for %d correct answers, want %d", total, correct, correct*basePoints)
+    }
+
+    game, err := b.DB.GetGame(1)
+    if err != nil {
+        t.Fatalf("loading game: %v", err)
+    }
+    if game.EndedAt.IsZero() || game.EndReason != endAdmin {
+        t.Errorf("game ended at %v for %q, want ended by %q", game.EndedAt, game.EndReason, endAdmin)
+    }
+}
+
+func TestAchievementsUnlockOnce(t *testing.T) {
+    b, fake := newTestBot(t,
+        &db.Question{Text: "Q1?", Answer: "a", Kind: db.KindText},
+        &db.Question{Text: "Q2?", Answer: "a", Kind: db.KindText},
+    )
+    send(b, testPlayer, "!!trivia join red")
+    send(b, testAdmin, "!!trivia start")
+    postedQuestion(t, b, fake)
+    send(b, testPlayer, "!!trivia answer a")
+    expect(t, fake, "unlocked the **First Blood** achievement")
+
+    fake.Reset()
+    send(b, testAdmin, "!!trivia next")
+    postedQuestion(t, b, fake)
+    send(b, testPlayer, "!!trivia answer a")
+    expect(t, fake, "+10 points!")
+    send(b, testAdmin, "!!trivia end")
+    expect(t, fake, "Trivia ended!")
+    for _, m := range fake.Messages() {
+        if strings.Contains(m.Content, "First Blood") {
+            t.Errorf("First Blood announced again: %s", m.Content)
+        }
+    }
+}
+
+func TestOnlyBotAdminsChangeAchievements(t *testing.T) {
+    const role = "100000000000000009"
+    fake := NewFakeTransport()
+    fake.AddMember(testGuild, &discordgo.Member{User: &discordgo.User{ID: testPlayer}, Roles: []string{role}})
+    cfg := &config.Config{AllowedChannels: []string{testChannel}, AdminIDs: []string{testAdmin}, AdminRoleIDs: []string{role}}
+    b := NewBotWithTransport(cfg, fake, db.NewMemory())
+
+    send(b, testPlayer, "!!trivia achievement remove first_blood")
+    expect(t, fake, "only the bot's admins can add or remove them")
+    send(b, testPlayer, "!!trivia achievement add Sharpshooter | Answer 50 questions correctly | correct=50")
+    fake.Reset()
+    send(b, testPlayer, "!!trivia achievement list")
+    list := expect(t, fake, "**Achievements**")
+    if !strings.Contains(list.Content, "First Blood") || strings.Contains(list.Content, "Sharpshooter") {
+        t.Errorf("a server admin changed the shared achievements:\n%s", list.Content)
+    }
+
+    send(b, testAdmin, "!!trivia achievement remove first_blood")
+    expect(t, fake, "Achievement removed")
+}
@@ -0,0 +1,246 @@
+package bot
+
+import (
+    "fmt"
+    "io"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/bwmarrin/discordgo"
+)
+
+// FakeMessage is something the bot sent through a FakeTransport: a channel
+// message, a reply, or an interaction response or follow-up.
+type FakeMessage struct {
+    ID            string
+    ChannelID     string
+    Content       string
+    Embeds        []*discordgo.MessageEmbed
+    Components    []discordgo.MessageComponent
+    Files         map[string][]byte
+    Reference     *discordgo.MessageReference // Set for replies
+    InteractionID string                      // Set for interaction responses
+    Ephemeral     bool
+    Edits         int
+}
+
+// Text joins the message content with its embed titles, descriptions and
+// fields, which is usually what a test wants to search.
+func (m FakeMessage) Text() string {
+    parts := []string{m.Content}
+    for _, embed := range m.Embeds {
+        parts = append(parts, embed.Title, embed.Description)
+        for _, field := range embed.Fields {
+            parts = append(parts, field.Name+": "+field.Value)
+        }
+    }
+    return strings.TrimSpace(strings.Join(parts, "\n"))
+}
+
+// FakeTransport is an in-memory Transport for running the bot without
+// Discord. It records every message in order and answers member lookups
+// from members added with AddMember.
+type FakeTransport struct {
+    mutex    sync.Mutex
+    messages []*FakeMessage
+    members  map[string]*discordgo.Member // Keyed by guild/user
+    nextID   int
+    changed  chan struct{}                // Closed and replaced on every change
+}
+
+var _ Transport = (*FakeTransport)(nil)
+
+func NewFakeTransport() *FakeTransport {
+    return &FakeTransport{
+        members: make(map[string]*discordgo.Member),
+        changed: make(chan struct{}),
+    }
+}
+
+// AddMember makes member visible to GuildMember lookups in the guild.
+func (f *FakeTransport) AddMember(guildID string, member *discordgo.Member) {
+    f.mutex.Lock()
+    defer f.mutex.Unlock()
+    f.members[guildID+"/"+member.User.ID] = member
+}
+
+// Messages returns copies of everything sent so far, oldest first.
+func (f *FakeTransport) Messages() []FakeMessage {
+    f.mutex.Lock()
+    defer f.mutex.Unlock()
+    messages := make([]FakeMessage, len(f.messages))
+    for i, m := range f.messages {
+        messages[i] = *m
+    }
+    return messages
+}
+
+// ChannelMessages returns what was sent to one channel, oldest first.
+func (f *FakeTransport) ChannelMessages(channelID string) []FakeMessage {
+    var messages []FakeMessage
+    for _, m := range f.Messages() {
+        if m.ChannelID == channelID {
+            messages = append(messages, m)
+        }
+    }
+    return messages
+}
+
+// Reset forgets all recorded messages.
+func (f *FakeTransport) Reset() {
+    f.mutex.Lock()
+    defer f.mutex.Unlock()
+    f.messages = nil
+    f.notify()
+}
+
+// WaitFor returns the first recorded message matching match, waiting up to
+// timeout for it to be sent. Games run in their own goroutine, so tests use
+// this instead of reading Messages straight after a command.
+func (f *FakeTransport) WaitFor(timeout time.Duration, match func(FakeMessage) bool) (FakeMessage, bool) {
+    deadline := time.After(timeout)
+    for {
+        f.mutex.Lock()
+        changed := f.changed
+        for _, m := range f.messages {
+            if match(*m) {
+                f.mutex.Unlock()
+                return *m, true
+            }
+        }
+        f.mutex.Unlock()
+
+        select {
+        case <-changed:
+        case <-deadline:
+            return FakeMessage{}, false
+        }
+    }
+}
+
+// WaitForText waits for a message whose Text contains substr.
+func (f *FakeTransport) WaitForText(timeout time.Duration, substr string) (FakeMessage, bool) {
+    return f.WaitFor(timeout, func(m FakeMessage) bool {
+        return strings.Contains(m.Text(), substr)
+    })
+}
+
+// notify wakes WaitFor callers. The caller holds the lock.
+func (f *FakeTransport) notify() {
+    close(f.changed)
+    f.changed = make(chan struct{})
+}
+
+func (f *FakeTransport) record(m *FakeMessage, files []*discordgo.File) (*discordgo.Message, error) {
+    for _, file := range files {
+        data, err := io.ReadAll(file.Reader)
+        if err != nil {
+            return nil, err
+        }
+        if m.Files == nil {
+            m.Files = make(map[string][]byte)
+        }
+        m.Files[file.Name] = data
+    }
+
+    f.mutex.Lock()
+    defer f.mutex.Unlock()
+    f.nextID++
+    m.ID = fmt.Sprint(f.nextID)
+    f.messages = append(f.messages, m)
+    f.notify()
+
+    return &discordgo.Message{
+        ID:         m.ID,
+        ChannelID:  m.ChannelID,
+        Content:    m.Content,
+        Embeds:     m.Embeds,
+        Components: m.Components,
+    }, nil
+}
+
+func (f *FakeTransport) ChannelMessageSend(channelID, content string) (*discordgo.Message, error) {
+    return f.record(&FakeMessage{ChannelID: channelID, Content: content}, nil)
+}
+
+func (f *FakeTransport) ChannelMessageSendReply(channelID, content string, reference *discordgo.MessageReference) (*discordgo.Message, error) {
+    return f.record(&FakeMessage{ChannelID: channelID, Content: content, Reference: reference}, nil)
+}
+
+func (f *FakeTransport) ChannelMessageSendEmbed(channelID string, embed *discordgo.MessageEmbed) (*discordgo.Message, error) {
+    return f.record(&FakeMessage{ChannelID: channelID, Embeds: []*discordgo.MessageEmbed{embed}}, nil)
+}
+
+func (f *FakeTransport) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend) (*discordgo.Message, error) {
+    return f.record(&FakeMessage{
+        ChannelID:  channelID,
+        Content:    data.Content,
+        Embeds:     data.Embeds,
+        Components: data.Components,
+        Reference:  data.Reference,
+    }, data.Files)
+}
+
+func (f *FakeTransport) ChannelMessageEditComplex(edit *discordgo.MessageEdit) (*discordgo.Message, error) {
+    f.mutex.Lock()
+    defer f.mutex.Unlock()
+    for _, m := range f.messages {
+        if m.ID != edit.ID || m.ChannelID != edit.Channel {
+            continue
+        }
+        if edit.Content != nil {
+            m.Content = *edit.Content
+        }
+        if edit.Embeds != nil {
+            m.Embeds = *edit.Embeds
+        }
+        if edit.Components != nil {
+            m.Components = *edit.Components
+        }
+        m.Edits++
+        f.notify()
+        return &discordgo.Message{ID: m.ID, ChannelID: m.ChannelID, Content: m.Content, Embeds: m.Embeds, Components: m.Components}, nil
+    }
+    return nil, fmt.Errorf("unknown message %s in channel %s", edit.ID, edit.Channel)
+}
+
+func (f *FakeTransport) InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse) error {
+    m := &FakeMessage{ChannelID: interaction.ChannelID, InteractionID: interaction.ID}
+    var files []*discordgo.File
+    if data := resp.Data; data != nil {
+        m.Content = data.Content
+        m.Embeds = data.Embeds
+        m.Components = data.Components
+        m.Ephemeral = data.Flags&discordgo.MessageFlagsEphemeral != 0
+        files = data.Files
+    }
+    _, err := f.record(m, files)
+    return err
+}
+
+func (f *FakeTransport) FollowupMessageCreate(interaction *discordgo.Interaction, wait bool, data *discordgo.WebhookParams) (*discordgo.Message, error) {
+    return f.record(&FakeMessage{
+        ChannelID:     interaction.ChannelID,
+        Content:       data.Content,
+        Embeds:        data.Embeds,
+        Components:    data.Components,
+        InteractionID: interaction.ID,
+        Ephemeral:     data.Flags&discordgo.MessageFlagsEphemeral != 0,
+    }, data.Files)
+}
+
+func (f *FakeTransport) GuildMember(guildID, userID string) (*discordgo.Member, error) {
+    f.mutex.Lock()
+    defer f.mutex.Unlock()
+    member, ok := f.members[guildID+"/"+userID]
+    if !ok {
+        return nil, fmt.Errorf("unknown member %s in guild %s", userID, guildID)
+    }
+    return member, nil
+}
+
+// UserChannelCreate returns a direct message channel with the ID "dm-<user ID>".
+func (f *FakeTransport) UserChannelCreate(userID string) (*discordgo.Channel, error) {
+    return &discordgo.Channel{ID: "dm-" + userID, Type: discordgo.ChannelTypeDM}, nil
+}
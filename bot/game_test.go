@@ -0,0 +1,190 @@
+package bot
+
+import (
+    "context"
+    "fmt"
+    "strings"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "github.com/airylvat/trivia-bot/config"
+    "github.com/airylvat/trivia-bot/db"
+
+    "github.com/bwmarrin/discordgo"
+)
+
+const (
+    testGuild   = "100000000000000001"
+    testChannel = "100000000000000002"
+    testAdmin   = "100000000000000003"
+    testPlayer  = "100000000000000004"
+)
+
+// waitTime bounds how long a test waits for a game to post something.
+const waitTime = 2 * time.Second
+
+var messageIDs atomic.Int64
+
+// newTestBot returns a bot with in-memory storage and a fake transport that
+// stops its games when the test ends.
+func newTestBot(t *testing.T, questions ...*db.Question) (*Bot, *FakeTransport) {
+    t.Helper()
+    store := db.NewMemory()
+    for _, q := range questions {
+        if err := store.AddQuestion(q); err != nil {
+            t.Fatalf("adding question: %v", err)
+        }
+    }
+    fake := NewFakeTransport()
+    cfg := &config.Config{AllowedChannels: []string{testChannel}, AdminIDs: []string{testAdmin}}
+    b := NewBotWithTransport(cfg, fake, store)
+    t.Cleanup(func() {
+        ctx, cancel := context.WithTimeout(context.Background(), waitTime)
+        defer cancel()
+        if err := b.Shutdown(ctx); err != nil {
+            t.Errorf("shutdown: %v", err)
+        }
+    })
+    return b, fake
+}
+
+// send runs a prefix command from the user in the test channel.
+func send(b *Bot, userID, content string) {
+    b.HandleMessage(&discordgo.MessageCreate{Message: &discordgo.Message{
+        ID:        fmt.Sprint(messageIDs.Add(1)),
+        ChannelID: testChannel,
+        GuildID:   testGuild,
+        Content:   content,
+        Author:    &discordgo.User{ID: userID, Username: "user" + userID[len(userID)-2:]},
+    }})
+}
+
+// expect waits for a message containing substr and fails the test without one.
+func expect(t *testing.T, fake *FakeTransport, substr string) FakeMessage {
+    t.Helper()
+    m, ok := fake.WaitForText(waitTime, substr)
+    if !ok {
+        t.Fatalf("no message containing %q; got:\n%s", substr, dump(fake))
+    }
+    return m
+}
+
+func dump(fake *FakeTransport) string {
+    var lines []string
+    for _, m := range fake.Messages() {
+        lines = append(lines, m.Text())
+    }
+    return strings.Join(lines, "\n---\n")
+}
+
+// postedQuestion waits for a question embed and returns the question it shows.
+func postedQuestion(t *testing.T, b *Bot, fake *FakeTransport) *db.Question {
+    t.Helper()
+    m, ok := fake.WaitFor(waitTime, func(m FakeMessage) bool {
+        return len(m.Embeds) > 0 && strings.HasPrefix(m.Embeds[0].Title, "Trivia Question # ")
+    })
+    if !ok {
+        t.Fatalf("no question posted; got:\n%s", dump(fake))
+    }
+    var id int
+    if _, err := fmt.Sscanf(m.Embeds[0].Title, "Trivia Question # %d", &id); err != nil {
+        t.Fatalf("reading question ID from %q: %v", m.Embeds[0].Title, err)
+    }
+    q, err := b.DB.GetQuestion(id)
+    if err != nil {
+        t.Fatalf("loading question %d: %v", id, err)
+    }
+    if m.Embeds[0].Description != q.Text {
+        t.Errorf("embed shows %q, want %q", m.Embeds[0].Description, q.Text)
+    }
+    return q
+}
+
+func TestFullGame(t *testing.T) {
+    b, fake := newTestBot(t,
+        &db.Question{Text: "What is 2+2?", Answer: "4", Kind: db.KindText, Difficulty: db.DifficultyEasy},
+        &db.Question{Text: "Longest river?", Answer: "Nile", Kind: db.KindText, Difficulty: db.DifficultyMedium},
+    )
+
+    send(b, testPlayer, "!!trivia join red")
+    expect(t, fake, "joined")
+
+    send(b, testAdmin, "!!trivia start")
+    expect(t, fake, "Game #1 rules: classic scoring")
+    expect(t, fake, "Trivia started!")
+    q := postedQuestion(t, b, fake)
+
+    fake.Reset()
+    send(b, testPlayer, "!!trivia answer wrong answer")
+    expect(t, fake, "Incorrect answer.")
+    send(b, testPlayer, "!!trivia answer "+q.Answer)
+    reply := expect(t, fake, "answered correctly for team red! +10 points!")
+    if reply.Reference == nil {
+        t.Error("the correct answer message is not a reply")
+    }
+
+    fake.Reset()
+    send(b, testAdmin, "!!trivia next")
+    next := postedQuestion(t, b, fake)
+    if next.ID == q.ID {
+        t.Errorf("question %d was asked twice", q.ID)
+    }
+    send(b, testPlayer, "!!trivia answer "+next.Answer)
+    expect(t, fake, "+10 points!")
+
+    fake.Reset()
+    send(b, testPlayer, "!!trivia results")
+    results := expect(t, fake, "**Game #1 Results**")
+    for _, want := range []string{"Still in progress", "<@" + testPlayer + "> (Team red): 20", "red: 20"} {
+        if !strings.Contains(results.Content, want) {
+            t.Errorf("results missing %q:\n%s", want, results.Content)
+        }
+    }
+
+    fake.Reset()
+    send(b, testAdmin, "!!trivia end")
+    expect(t, fake, "Trivia ended!")
+    if b.Games.Get(testGuild, testChannel) != nil {
+        t.Error("the game is still registered after ending")
+    }
+
+    fake.Reset()
+    send(b, testPlayer, "!!trivia results")
+    results = expect(t, fake, "**Game #1 Results**")
+    if !strings.Contains(results.Content, "Ended") || !strings.Contains(results.Content, "(admin) after 2 questions") {
+        t.Errorf("results don't show the game ended by an admin:\n%s", results.Content)
+    }
+}
+
+func TestGameMessagesUseGuildPrefix(t *testing.T) {
+    b, fake := newTestBot(t, &db.Question{Text: "Q?", Answer: "a", Kind: db.KindText})
+    send(b, testAdmin, "!!trivia config set prefix ?quiz")
+    expect(t, fake, "?quiz")
+
+    fake.Reset()
+    send(b, testAdmin, "?quiz start")
+    started := expect(t, fake, "Trivia started!")
+    if !strings.Contains(started.Content, "`?quiz next`") || strings.Contains(started.Content, "!!trivia") {
+        t.Errorf("start message doesn't use the guild's prefix: %s", started.Content)
+    }
+    postedQuestion(t, b, fake)
+    send(b, testPlayer, "?quiz answer a")
+    joinFirst := expect(t, fake, "You must join a team first")
+    if !strings.Contains(joinFirst.Content, "`?quiz join <team>`") {
+        t.Errorf("join hint doesn't use the guild's prefix: %s", joinFirst.Content)
+    }
+
+    for command, want := range map[string]string{
+        "?quiz results abc":  "Usage: `?quiz results [game id]`",
+        "?quiz config wrong":  "Usage: `?quiz config list`",
+        "?quiz config":       "`?quiz config set <setting> <value>`",
+    } {
+        fake.Reset()
+        send(b, testAdmin, command)
+        reply := expect(t, fake, "Usage:")
+        if !strings.Contains(reply.Content, want) || strings.Contains(reply.Content, "!!trivia") {
+            t.Errorf("%s replied %q, want it to contain %q", command, reply.Content, want)
+        }
+    }
+}
@@ -0,0 +1,101 @@
+package bot
+
+import (
+    "math"
+    "sort"
+    "time"
+)
+
+const (
+    basePoints  = 10               // Points for a correct answer under the classic rule
+    speedWindow = 30 * time.Second // Decay window for speed scoring when a question has no timer
+)
+
+// partialShares is the share of points awarded to the 1st, 2nd and 3rd correct
+// answers when a game gives partial credit.
+var partialShares = []float64{1, 0.5, 0.25}
+
+// ScoreContext is what a scoring rule knows about a correct answer.
+type ScoreContext struct {
+    BasePoints int
+    Elapsed    time.Duration // Time since the question was posted
+    TimeLimit  time.Duration // The question timer, 0 if there is none
+    Difficulty int
+}
+
+// ScoringRule decides how many points a correct answer is worth.
+type ScoringRule interface {
+    Name() string
+    Description() string
+    Points(sc ScoreContext) int
+}
+
+type classicScoring struct{}
+
+func (classicScoring) Name() string        { return "classic" }
+func (classicScoring) Description() string { return "a fixed number of points per correct answer" }
+func (classicScoring) Points(sc ScoreContext) int {
+    return sc.BasePoints
+}
+
+// speedScoring starts at double points and decays linearly to half points
+// over the question timer, or over speedWindow without one.
+type speedScoring struct{}
+
+func (speedScoring) Name() string        { return "speed" }
+func (speedScoring) Description() string { return "faster answers earn more points" }
+func (speedScoring) Points(sc ScoreContext) int {
+    window := sc.TimeLimit
+    if window <= 0 {
+        window = speedWindow
+    }
+    progress := math.Min(float64(sc.Elapsed)/float64(window), 1)
+    max, min := float64(sc.BasePoints*2), float64(sc.BasePoints)/2
+    return int(math.Round(max - (max-min)*progress))
+}
+
+type difficultyScoring struct{}
+
+func (difficultyScoring) Name() string        { return "difficulty" }
+func (difficultyScoring) Description() string { return "harder questions earn more points" }
+func (difficultyScoring) Points(sc ScoreContext) int {
+    difficulty := sc.Difficulty
+    if difficulty < 1 {
+        difficulty = 1
+    }
+    return sc.BasePoints * difficulty
+}
+
+var scoringRules = map[string]ScoringRule{}
+
+func registerScoring(rules ...ScoringRule) {
+    for _, rule := range rules {
+        scoringRules[rule.Name()] = rule
+    }
+}
+
+func init() {
+    registerScoring(classicScoring{}, speedScoring{}, difficultyScoring{})
+}
+
+// scoringNames lists the available rules for usage messages.
+func scoringNames() []string {
+    var names []string
+    for name := range scoringRules {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// partialPoints scales points for the rank-th correct answer, never going below 1.
+func partialPoints(points, rank int) int {
+    if rank < 1 || rank > len(partialShares) {
+        return 0
+    }
+    scaled := int(math.Round(float64(points) * partialShares[rank-1]))
+    if scaled < 1 {
+        scaled = 1
+    }
+    return scaled
+}
@@ -0,0 +1,387 @@
+package bot
+
+import (
+    "fmt"
+    "log"
+    "regexp"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+    "unicode"
+
+    "github.com/airylvat/trivia-bot/config"
+)
+
+const defaultIdleTimeout = 5 * time.Minute // Games end after this long without activity
+
+// GuildSettings are the values in effect for one guild: the bot-wide
+// defaults with the guild's own `!!trivia config set` changes on top.
+type GuildSettings struct {
+    Prefix          string
+    AllowedChannels []string
+    AdminRoles      []string // In addition to the bot-wide admin roles
+    Points          int      // Base points for a correct answer
+    IdleTimeout     time.Duration
+    QuestionTime    time.Duration // Default timer for new games, 0 for none
+    Intermission    time.Duration // Default pause before automatic questions, 0 to wait for `next`
+    DefaultCategory string        // Used when a game doesn't pick a category
+    CooldownGames   int           // Questions aren't reused for this many games, 0 for no limit
+    CooldownDays    int           // Questions aren't reused for this many days, 0 for no limit
+}
+
+// guildSetting is one value a guild can change with `!!trivia config set`.
+// Values are stored as text in the form parse returns.
+type guildSetting struct {
+    key         string
+    description string
+    parse       func(value string) (string, error) // Validates and normalizes a new value
+    apply       func(s *GuildSettings, value string)
+    show        func(s GuildSettings) string
+}
+
+var configurable = []*guildSetting{
+    {
+        key:         "prefix",
+        description: "Word that starts text commands",
+        parse:       parsePrefix,
+        apply:       func(s *GuildSettings, v string) { s.Prefix = v },
+        show:        func(s GuildSettings) string { return "`" + s.Prefix + "`" },
+    },
+    {
+        key:         "allowed_channels",
+        description: "Channels where commands work, replacing the bot-wide list",
+        parse:       parseIDList,
+        apply:       func(s *GuildSettings, v string) { s.AllowedChannels = strings.Split(v, ",") },
+        show:        func(s GuildSettings) string { return mentionList(s.AllowedChannels, "<#%s>") },
+    },
+    {
+        key:         "admin_roles",
+        description: "Roles whose members can use admin commands, besides the bot-wide ones",
+        parse:       parseIDList,
+        apply:       func(s *GuildSettings, v string) { s.AdminRoles = strings.Split(v, ",") },
+        show:        func(s GuildSettings) string { return mentionList(s.AdminRoles, "%s") },
+    },
+    {
+        key:         "points",
+        description: "Base points for a correct answer",
+        parse:       parseNumber(1, 1000),
+        apply:       func(s *GuildSettings, v string) { s.Points, _ = strconv.Atoi(v) },
+        show:        func(s GuildSettings) string { return strconv.Itoa(s.Points) },
+    },
+    {
+        key:         "idle_timeout",
+        description: "Seconds without activity before a game ends",
+        parse:       parseNumber(30, 86400),
+        apply:       func(s *GuildSettings, v string) { s.IdleTimeout = parseSeconds(v) },
+        show:        func(s GuildSettings) string { return showSeconds(s.IdleTimeout) },
+    },
+    {
+        key:         "question_timer",
+        description: "Default seconds per question for new games, 0 for no timer",
+        parse:       parseQuestionTimer,
+        apply:       func(s *GuildSettings, v string) { s.QuestionTime = parseSeconds(v) },
+        show:        func(s GuildSettings) string { return showSeconds(s.QuestionTime) },
+    },
+    {
+        key:         "intermission",
+        description: "Default seconds before the next question is posted automatically in timed games, 0 to wait for `next`",
+        parse:       parseNumber(0, 600),
+        apply:       func(s *GuildSettings, v string) { s.Intermission = parseSeconds(v) },
+        show:        func(s GuildSettings) string { return showSeconds(s.Intermission) },
+    },
+    {
+        key:         "default_category",
+        description: "Category used when a game doesn't pick one (`category=any` overrides it)",
+        parse:       parseCategory,
+        apply:       func(s *GuildSettings, v string) { s.DefaultCategory = v },
+        show:        func(s GuildSettings) string { return valueOr(s.DefaultCategory, "none") },
+    },
+    {
+        key:         "question_cooldown",
+        description: "Games or days before a question can be asked again in this server (e.g. `5 games` or `7 days`), 0 for none",
+        parse:       parseCooldown,
+        apply:       applyCooldown,
+        show:        showCooldown,
+    },
+}
+
+func findSetting(key string) *guildSetting {
+    for _, setting := range configurable {
+        if setting.key == key {
+            return setting
+        }
+    }
+    return nil
+}
+
+func settingKeys() []string {
+    var keys []string
+    for _, setting := range configurable {
+        keys = append(keys, setting.key)
+    }
+    return keys
+}
+
+func parsePrefix(value string) (string, error) {
+    if value == "" || len(value) > 20 || strings.IndexFunc(value, unicode.IsSpace) >= 0 {
+        return "", fmt.Errorf("the prefix must be a single word of up to 20 characters")
+    }
+    return value, nil
+}
+
+// mentionDigits strips channel and role mentions down to their IDs.
+var mentionDigits = regexp.MustCompile(`^<(?:#|@&)([0-9]+)>$`)
+
+// parseIDList reads channel or role IDs or mentions separated by commas or spaces.
+func parseIDList(value string) (string, error) {
+    var ids []string
+    for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+        if m := mentionDigits.FindStringSubmatch(item); m != nil {
+            item = m[1]
+        }
+        if !config.IsID(item) {
+            return "", fmt.Errorf("%q is not a channel or role ID or mention", item)
+        }
+        ids = append(ids, item)
+    }
+    if len(ids) == 0 {
+        return "", fmt.Errorf("give at least one ID, or use reset to go back to the default")
+    }
+    return strings.Join(ids, ","), nil
+}
+
+func parseNumber(min, max int) func(string) (string, error) {
+    return func(value string) (string, error) {
+        n, err := parseBounded("the value", value, min, max)
+        if err != nil {
+            return "", err
+        }
+        return strconv.Itoa(n), nil
+    }
+}
+
+func parseQuestionTimer(value string) (string, error) {
+    if value == "0" {
+        return value, nil
+    }
+    return parseNumber(5, 3600)(value)
+}
+
+func parseCategory(value string) (string, error) {
+    if value == "" || len(value) > 100 {
+        return "", fmt.Errorf("the category must be 1 to 100 characters")
+    }
+    return value, nil
+}
+
+// parseCooldown reads a question cooldown such as "5 games" or "7 days".
+func parseCooldown(value string) (string, error) {
+    value = strings.ToLower(value)
+    if value == "0" || value == "off" {
+        return "0", nil
+    }
+    number, unit := cutWord(value)
+    n, err := parseBounded("the cooldown", number, 1, 1000)
+    if err != nil {
+        return "", err
+    }
+    switch unit {
+    case "game", "games":
+        return fmt.Sprintf("%d games", n), nil
+    case "day", "days":
+        return fmt.Sprintf("%d days", n), nil
+    }
+    return "", fmt.Errorf("give the cooldown in games or days, e.g. `5 games` or `7 days`")
+}
+
+func applyCooldown(s *GuildSettings, value string) {
+    s.CooldownGames, s.CooldownDays = 0, 0
+    number, unit := cutWord(value)
+    n, _ := strconv.Atoi(number)
+    if unit == "games" {
+        s.CooldownGames = n
+    } else if unit == "days" {
+        s.CooldownDays = n
+    }
+}
+
+func showCooldown(s GuildSettings) string {
+    switch {
+    case s.CooldownGames > 0:
+        return fmt.Sprintf("%d games", s.CooldownGames)
+    case s.CooldownDays > 0:
+        return fmt.Sprintf("%d days", s.CooldownDays)
+    }
+    return "off"
+}
+
+func parseSeconds(value string) time.Duration {
+    seconds, _ := strconv.Atoi(value)
+    return time.Duration(seconds) * time.Second
+}
+
+func showSeconds(d time.Duration) string {
+    if d == 0 {
+        return "off"
+    }
+    return fmt.Sprintf("%d seconds", int(d.Seconds()))
+}
+
+func mentionList(ids []string, format string) string {
+    if len(ids) == 0 {
+        return "none"
+    }
+    var mentions []string
+    for _, id := range ids {
+        mentions = append(mentions, fmt.Sprintf(format, id))
+    }
+    return strings.Join(mentions, ", ")
+}
+
+// settingsCache keeps each guild's effective settings so messages don't hit
+// the database. Entries are dropped when a setting changes.
+type settingsCache struct {
+    byGuild map[string]GuildSettings
+    mutex   sync.Mutex
+}
+
+func (sc *settingsCache) get(guildID string) (GuildSettings, bool) {
+    sc.mutex.Lock()
+    defer sc.mutex.Unlock()
+    s, ok := sc.byGuild[guildID]
+    return s, ok
+}
+
+func (sc *settingsCache) put(guildID string, s GuildSettings) {
+    sc.mutex.Lock()
+    defer sc.mutex.Unlock()
+    if sc.byGuild == nil {
+        sc.byGuild = make(map[string]GuildSettings)
+    }
+    sc.byGuild[guildID] = s
+}
+
+func (sc *settingsCache) forget(guildID string) {
+    sc.mutex.Lock()
+    defer sc.mutex.Unlock()
+    delete(sc.byGuild, guildID)
+}
+
+// defaultSettings are the settings of a guild that hasn't changed any.
+func (b *Bot) defaultSettings() GuildSettings {
+    return GuildSettings{
+        Prefix:          commandPrefix,
+        AllowedChannels: b.Config.AllowedChannels,
+        Points:          basePoints,
+        IdleTimeout:     defaultIdleTimeout,
+    }
+}
+
+// guildSettings returns the effective settings for a guild. Direct messages
+// have no guild and always use the defaults.
+func (b *Bot) guildSettings(guildID string) GuildSettings {
+    if s, ok := b.settings.get(guildID); ok {
+        return s
+    }
+    s := b.defaultSettings()
+    if guildID == "" {
+        return s
+    }
+
+    stored, err := b.DB.GetGuildSettings(guildID)
+    if err != nil {
+        log.Printf("Error loading settings for guild %s: %v", guildID, err)
+        return s
+    }
+    for key, value := range stored {
+        if setting := findSetting(key); setting != nil {
+            setting.apply(&s, value)
+        }
+    }
+    b.settings.put(guildID, s)
+    return s
+}
+
+// cutWord splits off the first word of s.
+func cutWord(s string) (word, rest string) {
+    s = strings.TrimSpace(s)
+    i := strings.IndexFunc(s, unicode.IsSpace)
+    if i < 0 {
+        return s, ""
+    }
+    return s[:i], strings.TrimSpace(s[i:])
+}
+
+const configUsage = "Usage: `!!trivia config list`, `!!trivia config get <setting>`, `!!trivia config set <setting> <value>` or `!!trivia config reset <setting>`"
+
+func (b *Bot) handleConfig(c *Context) {
+    if c.GuildID == "" {
+        c.Reply("Settings can only be changed in a server.")
+        return
+    }
+
+    action, rest := cutWord(c.Args)
+    action = strings.ToLower(action)
+    if action == "" || action == "list" {
+        b.listSettings(c)
+        return
+    }
+
+    key, value := cutWord(rest)
+    setting := findSetting(strings.ToLower(key))
+    if setting == nil {
+        c.Reply(fmt.Sprintf("Unknown setting %q. Settings: %s.\n%s", key, strings.Join(settingKeys(), ", "), b.prefixed(c.GuildID, configUsage)))
+        return
+    }
+
+    switch action {
+    case "get":
+        s := b.guildSettings(c.GuildID)
+        c.Reply(fmt.Sprintf("**%s**: %s\n%s.", setting.key, setting.show(s), setting.description))
+    case "set":
+        stored, err := setting.parse(value)
+        if err != nil {
+            c.Reply(fmt.Sprintf("Error: %s.", err))
+            return
+        }
+        if err := b.DB.SetGuildSetting(c.GuildID, setting.key, stored); err != nil {
+            c.Reply("Error saving setting.")
+            log.Printf("Setting save error: %v", err)
+            return
+        }
+        b.settings.forget(c.GuildID)
+        c.Reply(fmt.Sprintf("Set **%s** to %s.", setting.key, setting.show(b.guildSettings(c.GuildID))))
+    case "reset":
+        if err := b.DB.ResetGuildSetting(c.GuildID, setting.key); err != nil {
+            c.Reply("Error resetting setting.")
+            log.Printf("Setting reset error: %v", err)
+            return
+        }
+        b.settings.forget(c.GuildID)
+        c.Reply(fmt.Sprintf("Reset **%s** to the default, %s.", setting.key, setting.show(b.guildSettings(c.GuildID))))
+    default:
+        c.Reply(b.prefixed(c.GuildID, configUsage))
+    }
+}
+
+func (b *Bot) listSettings(c *Context) {
+    stored, err := b.DB.GetGuildSettings(c.GuildID)
+    if err != nil {
+        c.Reply("Error loading settings.")
+        log.Printf("Settings load error: %v", err)
+        return
+    }
+
+    s := b.guildSettings(c.GuildID)
+    lines := []string{"**Server Settings**"}
+    for _, setting := range configurable {
+        line := fmt.Sprintf("- **%s**: %s", setting.key, setting.show(s))
+        if _, changed := stored[setting.key]; !changed {
+            line += " (default)"
+        }
+        lines = append(lines, line+" - "+setting.description)
+    }
+    lines = append(lines, "", b.prefixed(c.GuildID, configUsage))
+    c.Reply(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,94 @@
+package bot
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "sync"
+)
+
+// drain tracks work in progress so shutdown can wait for it. Once closed,
+// no new work starts.
+type drain struct {
+    closing bool
+    wg      sync.WaitGroup
+    mutex   sync.Mutex
+}
+
+// start registers new work, or returns false if the bot is shutting down.
+func (d *drain) start() bool {
+    d.mutex.Lock()
+    defer d.mutex.Unlock()
+    if d.closing {
+        return false
+    }
+    d.wg.Add(1)
+    return true
+}
+
+func (d *drain) done() {
+    d.wg.Done()
+}
+
+func (d *drain) close() {
+    d.mutex.Lock()
+    d.closing = true
+    d.mutex.Unlock()
+}
+
+// wait blocks until all started work is done or ctx ends.
+func (d *drain) wait(ctx context.Context) error {
+    return waitFor(ctx, &d.wg)
+}
+
+// waitFor waits on wg, giving up when ctx ends.
+func waitFor(ctx context.Context, wg *sync.WaitGroup) error {
+    finished := make(chan struct{})
+    go func() {
+        wg.Wait()
+        close(finished)
+    }()
+    select {
+    case <-finished:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+// Shutdown stops the bot cleanly: it stops taking commands, waits for
+// running ones, saves and pauses every active game, then closes the Discord
+// session and the store. ctx bounds how long it waits for commands and games.
+// If games are still running when ctx ends, the store is left open for them
+// and the shutdown is reported as unclean.
+func (b *Bot) Shutdown(ctx context.Context) error {
+    log.Println("Shutting down: no longer accepting commands")
+    b.commands.close()
+    if err := b.commands.wait(ctx); err != nil {
+        log.Printf("Commands still running after the drain timeout, shutting down anyway: %v", err)
+    }
+
+    for _, t := range b.Games.Active("") {
+        if err := t.PauseContext(ctx); err != nil && !errors.Is(err, ErrGameNotRunning) {
+            log.Printf("Error pausing game in channel %s: %v", t.ChannelID, err)
+        }
+    }
+
+    var errs []error
+    stopped := waitFor(ctx, &b.loops)
+    if b.Session != nil {
+        if err := b.Session.Close(); err != nil {
+            errs = append(errs, err)
+        }
+    }
+    if stopped != nil {
+        // Closing the store now would pull it out from under the games
+        log.Printf("Games still stopping after the drain timeout, leaving the database open: %v", stopped)
+        errs = append(errs, fmt.Errorf("unclean shutdown, games still running: %w", stopped))
+    } else if err := b.DB.Close(); err != nil {
+        errs = append(errs, err)
+    }
+    log.Println("Shutdown complete")
+    return errors.Join(errs...)
+}
@@ -0,0 +1,476 @@
+package bot
+
+import (
+    "fmt"
+    "log"
+    "sort"
+    "strings"
+
+    "github.com/airylvat/trivia-bot/metrics"
+
+    "github.com/bwmarrin/discordgo"
+)
+
+const commandPrefix = "!!trivia"
+
+// command describes one trivia subcommand. The same handler serves both the
+// `!!trivia <name>` prefix form and the `/trivia <name>` slash form.
+type command struct {
+    name        string
+    description string
+    admin       bool
+    anyChannel  bool // Usable outside the allowed channels, so admins can fix the channel list
+    options     []*discordgo.ApplicationCommandOption
+    // args turns slash command options into the argument string the prefix
+    // form would have had. When nil, option values are joined with spaces.
+    args    func(opts map[string]string) string
+    handler func(b *Bot, c *Context)
+}
+
+var commands = []*command{
+    {
+        name:        "help",
+        description: "Show the trivia help message",
+        handler:     (*Bot).handleHelp,
+    },
+    {
+        name:        "join",
+        description: "Join a team",
+        options: []*discordgo.ApplicationCommandOption{
+            {Type: discordgo.ApplicationCommandOptionString, Name: "team", Description: "Team name (case-insensitive)", Required: true},
+        },
+        handler: (*Bot).handleJoin,
+    },
+    {
+        name:        "answer",
+        description: "Answer the current question",
+        options: []*discordgo.ApplicationCommandOption{
+            {Type: discordgo.ApplicationCommandOptionString, Name: "answer", Description: "Your answer (case-insensitive)", Required: true},
+        },
+        handler: (*Bot).handleAnswer,
+    },
+    {
+        name:        "scores",
+        description: "Show all-time player and team scores",
+        handler:     (*Bot).handleScores,
+    },
+    {
+        name:        "results",
+        description: "Show a game's scoreboard (defaults to the latest game)",
+        options: []*discordgo.ApplicationCommandOption{
+            {Type: discordgo.ApplicationCommandOptionInteger, Name: "game", Description: "Game ID from /trivia history"},
+        },
+        handler: (*Bot).handleResults,
+    },
+    {
+        name:        "profile",
+        description: "Show a player's lifetime stats in this server",
+        options: []*discordgo.ApplicationCommandOption{
+            {Type: discordgo.ApplicationCommandOptionUser, Name: "user", Description: "Player to show (defaults to you)"},
+        },
+        handler: (*Bot).handleProfile,
+    },
+    {
+        name:        "badges",
+        description: "Show the achievements a player has unlocked",
+        options: []*discordgo.ApplicationCommandOption{
+            {Type: discordgo.ApplicationCommandOptionUser, Name: "user", Description: "Player to show (defaults to you)"},
+        },
+        handler: (*Bot).handleBadges,
+    },
+    {
+        name:        "history",
+        description: "List recent games and their winners",
+        handler:     (*Bot).handleHistory,
+    },
+    {
+        name:        "categories",
+        description: "List question categories",
+        handler:     (*Bot).handleCategories,
+    },
+    {
+        name:        "start",
+        description: "Start a trivia game in this channel",
+        admin:       true,
+        options: []*discordgo.ApplicationCommandOption{
+            {Type: discordgo.ApplicationCommandOptionString, Name: "category", Description: "Only ask questions from this category"},
+            difficultyOption("Only ask questions of this difficulty"),
+            {Type: discordgo.ApplicationCommandOptionString, Name: "tag", Description: "Only ask questions with this tag"},
+            {Type: discordgo.ApplicationCommandOptionInteger, Name: "timer", Description: "Seconds per question before the answer is revealed", MinValue: floatPtr(5), MaxValue: 3600},
+            {Type: discordgo.ApplicationCommandOptionInteger, Name: "intermission", Description: "Seconds before the next question is posted automatically (needs a timer)", MinValue: floatPtr(0), MaxValue: 600},
+            {Type: discordgo.ApplicationCommandOptionInteger, Name: "questions", Description: "Number of questions in the game", MinValue: floatPtr(1), MaxValue: 1000},
+            {
+                Type:        discordgo.ApplicationCommandOptionString,
+                Name:        "scoring",
+                Description: "How points are awarded (defaults to classic)",
+                Choices: []*discordgo.ApplicationCommandOptionChoice{
+                    {Name: "classic: fixed points", Value: "classic"},
+                    {Name: "speed: faster answers earn more", Value: "speed"},
+                    {Name: "difficulty: harder questions earn more", Value: "difficulty"},
+                },
+            },
+            {Type: discordgo.ApplicationCommandOptionBoolean, Name: "partial", Description: "Also reward the 2nd and 3rd correct answers"},
+        },
+        args:    keyValueArgs,
+        handler: (*Bot).handleStart,
+    },
+    {
+        name:        "end",
+        description: "End the trivia game in this channel",
+        admin:       true,
+        handler:     (*Bot).handleEnd,
+    },
+    {
+        name:        "next",
+        description: "Post the next question",
+        admin:       true,
+        handler:     (*Bot).handleNext,
+    },
+    {
+        name:        "reset",
+        description: "Reset this server's scores and teams",
+        admin:       true,
+        handler:     (*Bot).handleReset,
+    },
+    {
+        name:        "list",
+        description: "List the questions in the database",
+        admin:       true,
+        options: []*discordgo.ApplicationCommandOption{
+            {
+                Type:        discordgo.ApplicationCommandOptionString,
+                Name:        "show",
+                Description: "What to show (defaults to the question count)",
+                Choices: []*discordgo.ApplicationCommandOptionChoice{
+                    {Name: "count", Value: "count"},
+                    {Name: "questions", Value: "questions"},
+                    {Name: "answers", Value: "answers"},
+                },
+            },
+        },
+        handler: (*Bot).handleListQuestions,
+    },
+    {
+        name:        "addq",
+        description: "Add a question",
+        admin:       true,
+        options: []*discordgo.ApplicationCommandOption{
+            {Type: discordgo.ApplicationCommandOptionString, Name: "question", Description: "Question text", Required: true},
+            {Type: discordgo.ApplicationCommandOptionString, Name: "answer", Description: "Correct answer", Required: true},
+            {Type: discordgo.ApplicationCommandOptionString, Name: "wrong1", Description: "Wrong answer, makes the question multiple choice"},
+            {Type: discordgo.ApplicationCommandOptionString, Name: "wrong2", Description: "Another wrong answer"},
+            {Type: discordgo.ApplicationCommandOptionString, Name: "wrong3", Description: "Another wrong answer"},
+            {Type: discordgo.ApplicationCommandOptionString, Name: "aliases", Description: "Other accepted answers, separated by semicolons"},
+            {Type: discordgo.ApplicationCommandOptionBoolean, Name: "exact", Description: "Only accept the exact answer, without typo forgiveness"},
+            {Type: discordgo.ApplicationCommandOptionString, Name: "category", Description: "Question category"},
+            {Type: discordgo.ApplicationCommandOptionString, Name: "tags", Description: "Tags, separated by commas"},
+            difficultyOption("Question difficulty (defaults to medium)"),
+        },
+        args: func(opts map[string]string) string {
+            args := opts["question"] + " | " + opts["answer"]
+            for _, name := range []string{"wrong1", "wrong2", "wrong3"} {
+                if wrong, ok := opts[name]; ok {
+                    args += " | " + wrong
+                }
+            }
+            for _, name := range []string{"aliases", "exact", "category", "tags", "difficulty"} {
+                if value, ok := opts[name]; ok {
+                    args += " | " + name + "=" + value
+                }
+            }
+            return args
+        },
+        handler: (*Bot).handleAddQuestion,
+    },
+    {
+        name:        "import",
+        description: "Import questions from a JSON or CSV file (previewed before saving)",
+        admin:       true,
+        options: []*discordgo.ApplicationCommandOption{
+            {Type: discordgo.ApplicationCommandOptionAttachment, Name: "file", Description: "JSON or CSV file to preview"},
+            {
+                Type:        discordgo.ApplicationCommandOptionString,
+                Name:        "action",
+                Description: "Save or discard the previewed import",
+                Choices: []*discordgo.ApplicationCommandOptionChoice{
+                    {Name: "confirm", Value: "confirm"},
+                    {Name: "cancel", Value: "cancel"},
+                },
+            },
+        },
+        handler: (*Bot).handleImport,
+    },
+    {
+        name:        "export",
+        description: "Export the question bank as a file",
+        admin:       true,
+        options: []*discordgo.ApplicationCommandOption{
+            {
+                Type:        discordgo.ApplicationCommandOptionString,
+                Name:        "format",
+                Description: "File format (defaults to JSON)",
+                Choices: []*discordgo.ApplicationCommandOptionChoice{
+                    {Name: "json", Value: "json"},
+                    {Name: "csv", Value: "csv"},
+                },
+            },
+        },
+        handler: (*Bot).handleExport,
+    },
+    {
+        name:        "removeq",
+        description: "Remove a question by ID",
+        admin:       true,
+        options: []*discordgo.ApplicationCommandOption{
+            {Type: discordgo.ApplicationCommandOptionInteger, Name: "id", Description: "Question ID", Required: true},
+        },
+        handler: (*Bot).handleRemoveQuestion,
+    },
+    {
+        name:        "qstats",
+        description: "Show how players have done on a question",
+        admin:       true,
+        options: []*discordgo.ApplicationCommandOption{
+            {Type: discordgo.ApplicationCommandOptionInteger, Name: "id", Description: "Question ID", Required: true},
+        },
+        handler: (*Bot).handleQuestionStats,
+    },
+    {
+        name:        "calibrate",
+        description: "Suggest difficulty changes from how often questions are answered correctly",
+        admin:       true,
+        options: []*discordgo.ApplicationCommandOption{
+            {Type: discordgo.ApplicationCommandOptionInteger, Name: "min_attempts", Description: "Attempts a question needs to be judged (defaults to 10)", MinValue: floatPtr(1), MaxValue: 10000},
+        },
+        handler: (*Bot).handleCalibrate,
+    },
+    {
+        name:        "achievement",
+        description: "List, add or remove achievements",
+        admin:       true,
+        options: []*discordgo.ApplicationCommandOption{
+            {
+                Type:        discordgo.ApplicationCommandOptionString,
+                Name:        "action",
+                Description: "What to do (defaults to list)",
+                Choices: []*discordgo.ApplicationCommandOptionChoice{
+                    {Name: "list", Value: "list"},
+                    {Name: "add", Value: "add"},
+                    {Name: "remove", Value: "remove"},
+                },
+            },
+            {Type: discordgo.ApplicationCommandOptionString, Name: "name", Description: "Name of a new achievement"},
+            {Type: discordgo.ApplicationCommandOptionString, Name: "description", Description: "How to earn a new achievement"},
+            {Type: discordgo.ApplicationCommandOptionString, Name: "metric", Description: "What a new achievement measures", Choices: metricChoices()},
+            {Type: discordgo.ApplicationCommandOptionInteger, Name: "threshold", Description: "Value of the metric that unlocks a new achievement", MinValue: floatPtr(1), MaxValue: 100000},
+            {Type: discordgo.ApplicationCommandOptionString, Name: "key", Description: "Achievement to remove"},
+        },
+        args: func(opts map[string]string) string {
+            switch opts["action"] {
+            case "add":
+                return "add " + opts["name"] + " | " + opts["description"] + " | " + opts["metric"] + "=" + opts["threshold"]
+            case "remove":
+                return "remove " + opts["key"]
+            }
+            return opts["action"]
+        },
+        handler: (*Bot).handleAchievement,
+    },
+    {
+        name:        "config",
+        description: "Show or change this server's trivia settings",
+        admin:       true,
+        anyChannel:  true,
+        options: []*discordgo.ApplicationCommandOption{
+            {
+                Type:        discordgo.ApplicationCommandOptionString,
+                Name:        "action",
+                Description: "What to do (defaults to list)",
+                Choices: []*discordgo.ApplicationCommandOptionChoice{
+                    {Name: "list", Value: "list"},
+                    {Name: "get", Value: "get"},
+                    {Name: "set", Value: "set"},
+                    {Name: "reset", Value: "reset"},
+                },
+            },
+            {Type: discordgo.ApplicationCommandOptionString, Name: "setting", Description: "Setting name", Choices: settingChoices()},
+            {Type: discordgo.ApplicationCommandOptionString, Name: "value", Description: "New value, for set"},
+        },
+        args: func(opts map[string]string) string {
+            return strings.Join([]string{opts["action"], opts["setting"], opts["value"]}, " ")
+        },
+        handler: (*Bot).handleConfig,
+    },
+    {
+        name:        "dashboard",
+        description: "Get a login link for the question bank dashboard by direct message",
+        admin:       true,
+        anyChannel:  true,
+        handler:     (*Bot).handleDashboard,
+    },
+}
+
+func settingChoices() []*discordgo.ApplicationCommandOptionChoice {
+    var choices []*discordgo.ApplicationCommandOptionChoice
+    for _, key := range settingKeys() {
+        choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: key, Value: key})
+    }
+    return choices
+}
+
+func metricChoices() []*discordgo.ApplicationCommandOptionChoice {
+    var choices []*discordgo.ApplicationCommandOptionChoice
+    for _, name := range metricNames() {
+        choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: name, Value: name})
+    }
+    return choices
+}
+
+func floatPtr(f float64) *float64 {
+    return &f
+}
+
+func difficultyOption(description string) *discordgo.ApplicationCommandOption {
+    return &discordgo.ApplicationCommandOption{
+        Type:        discordgo.ApplicationCommandOptionString,
+        Name:        "difficulty",
+        Description: description,
+        Choices: []*discordgo.ApplicationCommandOptionChoice{
+            {Name: "easy", Value: "easy"},
+            {Name: "medium", Value: "medium"},
+            {Name: "hard", Value: "hard"},
+        },
+    }
+}
+
+// keyValueArgs passes slash options as `key=value` arguments, in a stable order.
+func keyValueArgs(opts map[string]string) string {
+    keys := make([]string, 0, len(opts))
+    for key := range opts {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+
+    var args []string
+    for _, key := range keys {
+        args = append(args, key+"="+opts[key])
+    }
+    return strings.Join(args, " ")
+}
+
+var commandsByName = func() map[string]*command {
+    byName := make(map[string]*command, len(commands))
+    for _, cmd := range commands {
+        byName[cmd.name] = cmd
+    }
+    return byName
+}()
+
+// slashCommand builds the `/trivia` application command with one subcommand
+// per entry in commands.
+func slashCommand() *discordgo.ApplicationCommand {
+    dmPermission := false
+    root := &discordgo.ApplicationCommand{
+        Name:         strings.TrimLeft(commandPrefix, "!"),
+        Description:  "Play and manage trivia",
+        DMPermission: &dmPermission,
+    }
+    for _, cmd := range commands {
+        root.Options = append(root.Options, &discordgo.ApplicationCommandOption{
+            Type:        discordgo.ApplicationCommandOptionSubCommand,
+            Name:        cmd.name,
+            Description: cmd.description,
+            Options:     cmd.options,
+        })
+    }
+    return root
+}
+
+// registerSlashCommands publishes `/trivia` globally, replacing any earlier version.
+func (b *Bot) registerSlashCommands() error {
+    _, err := b.Session.ApplicationCommandBulkOverwrite(b.Session.State.User.ID, "", []*discordgo.ApplicationCommand{slashCommand()})
+    if err != nil {
+        return err
+    }
+    log.Println("Registered /trivia slash commands")
+    return nil
+}
+
+func (b *Bot) handleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+    b.HandleInteraction(i)
+}
+
+// HandleInteraction runs a `/trivia` slash command or an answer button click.
+func (b *Bot) HandleInteraction(i *discordgo.InteractionCreate) {
+    if !b.commands.start() {
+        c := newInteractionContext(b.Transport, i, "")
+        c.ReplyPrivate("Trivia is restarting. Try again in a moment.")
+        return
+    }
+    defer b.commands.done()
+
+    if i.Type == discordgo.InteractionMessageComponent {
+        if strings.HasPrefix(i.MessageComponentData().CustomID, choiceButtonPrefix) {
+            c := newInteractionContext(b.Transport, i, "")
+            b.handleChoice(c)
+            c.finish()
+        }
+        return
+    }
+    if i.Type != discordgo.InteractionApplicationCommand {
+        return
+    }
+
+    data := i.ApplicationCommandData()
+    if data.Name != slashCommand().Name || len(data.Options) == 0 {
+        return
+    }
+
+    sub := data.Options[0]
+    cmd, ok := commandsByName[sub.Name]
+    if !ok {
+        return
+    }
+
+    opts := make(map[string]string, len(sub.Options))
+    var values []string
+    var attachments []*discordgo.MessageAttachment
+    for _, opt := range sub.Options {
+        if opt.Type == discordgo.ApplicationCommandOptionAttachment {
+            if data.Resolved != nil {
+                if attachment, ok := data.Resolved.Attachments[fmt.Sprint(opt.Value)]; ok {
+                    attachments = append(attachments, attachment)
+                }
+            }
+            continue
+        }
+        value := fmt.Sprint(opt.Value)
+        if opt.Type == discordgo.ApplicationCommandOptionInteger {
+            value = fmt.Sprint(opt.IntValue())
+        }
+        opts[opt.Name] = value
+        values = append(values, value)
+    }
+
+    args := strings.Join(values, " ")
+    if cmd.args != nil {
+        args = cmd.args(opts)
+    }
+
+    c := newInteractionContext(b.Transport, i, strings.TrimSpace(args))
+    c.Attachments = attachments
+    if !cmd.anyChannel && !b.channelAllowed(c.GuildID, c.ChannelID) {
+        metrics.Commands.WithLabelValues(cmd.name, metrics.OutcomeWrongChannel).Inc()
+        c.ReplyPrivate("Trivia commands are not enabled in this channel.")
+        return
+    }
+    if cmd.admin && !b.isAdmin(c) {
+        metrics.Commands.WithLabelValues(cmd.name, metrics.OutcomeForbidden).Inc()
+        c.ReplyPrivate("Only trivia admins can use this command.")
+        return
+    }
+
+    cmd.handler(b, c)
+    c.finish()
+    metrics.Commands.WithLabelValues(cmd.name, c.outcome()).Inc()
+}
@@ -0,0 +1,193 @@
+package bot
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "time"
+
+    "github.com/airylvat/trivia-bot/db"
+)
+
+// gameState is the part of a Trivia that is saved so a game can continue
+// after the bot restarts. It is stored as JSON in the game_state table.
+type gameState struct {
+    Filter        db.QuestionFilter `json:"filter"`
+    QuestionTime  time.Duration     `json:"question_time"`
+    Intermission  time.Duration     `json:"intermission"`
+    QuestionLimit int               `json:"question_limit"`
+    Asked         int               `json:"asked"`
+    Scoring       string            `json:"scoring"`
+    BasePoints    int               `json:"base_points"`
+    PartialCredit bool              `json:"partial_credit"`
+    IdleTimeout   time.Duration     `json:"idle_timeout"`
+
+    // The current question, if one was posted
+    QuestionID      int            `json:"question_id,omitempty"`
+    StartedAt       time.Time      `json:"started_at,omitempty"`
+    AnsweredCorrect bool           `json:"answered,omitempty"`
+    Closed          bool           `json:"closed,omitempty"`
+    Awards          []Award        `json:"awards,omitempty"`
+    Options         []string       `json:"options,omitempty"`
+    CorrectOption   int            `json:"correct_option,omitempty"`
+    Picks           map[string]int `json:"picks,omitempty"`
+    MessageID       string         `json:"message_id,omitempty"`
+}
+
+// snapshot captures the game's state for saving, or returns nil if it has
+// ended.
+func (t *Trivia) snapshot() *db.SavedGame {
+    if !t.running() {
+        return nil
+    }
+
+    state := gameState{
+        Filter:        t.Filter,
+        QuestionTime:  t.QuestionTime,
+        Intermission:  t.Intermission,
+        QuestionLimit: t.QuestionLimit,
+        Asked:         t.Asked,
+        Scoring:       t.Scoring.Name(),
+        BasePoints:    t.BasePoints,
+        PartialCredit: t.PartialCredit,
+        IdleTimeout:   t.IdleTimeout,
+    }
+    if t.Current != nil {
+        state.QuestionID = t.Current.ID
+        state.StartedAt = t.StartTime
+        state.AnsweredCorrect = t.AnsweredCorrect
+        state.Closed = t.Status == statusClosed
+        state.Awards = t.Awards
+        state.Options = t.Options
+        state.CorrectOption = t.CorrectOption
+        state.Picks = t.Picks
+        state.MessageID = t.MessageID
+    }
+
+    encoded, _ := json.Marshal(state) // Only plain fields, so this can't fail
+    return &db.SavedGame{
+        GameID:    t.GameID,
+        GuildID:   t.GuildID,
+        ChannelID: t.ChannelID,
+        State:     string(encoded),
+    }
+}
+
+// restore loads saved state into a fresh game. current is the saved current
+// question, or nil if there was none or it has since been removed. An open
+// question gets a fresh timer, since the bot was down for part of it.
+func (t *Trivia) restore(saved db.SavedGame, state gameState, current *db.Question) {
+    t.GameID = saved.GameID
+    t.Filter = state.Filter
+    t.QuestionTime = state.QuestionTime
+    t.Intermission = state.Intermission
+    t.QuestionLimit = state.QuestionLimit
+    t.Asked = state.Asked
+    if rule, ok := scoringRules[state.Scoring]; ok {
+        t.Scoring = rule
+    }
+    t.BasePoints = state.BasePoints
+    t.PartialCredit = state.PartialCredit
+    if state.IdleTimeout > 0 {
+        t.IdleTimeout = state.IdleTimeout
+    }
+
+    if current == nil {
+        return
+    }
+    t.Status = statusOpen
+    if state.Closed {
+        t.Status = statusClosed
+    }
+    t.Current = current
+    t.StartTime = time.Now()
+    if t.QuestionTime > 0 {
+        t.Deadline = t.StartTime.Add(t.QuestionTime)
+    }
+    t.AnsweredCorrect = state.AnsweredCorrect
+    t.Awards = state.Awards
+    t.Options = state.Options
+    t.CorrectOption = state.CorrectOption
+    t.Picks = state.Picks
+    if t.Picks == nil && len(t.Options) > 0 {
+        t.Picks = make(map[string]int) // Nobody had picked yet
+    }
+    t.MessageID = state.MessageID
+}
+
+// saveGame records the game's state so it can be resumed after a restart.
+// It is called whenever the game changes.
+func (b *Bot) saveGame(t *Trivia) {
+    saved := t.snapshot()
+    if saved == nil {
+        return
+    }
+    if err := b.DB.SaveGameState(saved); err != nil {
+        log.Printf("Error saving state of game %d: %v", saved.GameID, err)
+    }
+}
+
+// ResumeGames restarts the games that were running when the bot last
+// stopped, re-posting each one's open question.
+func (b *Bot) ResumeGames() {
+    saved, err := b.DB.ListGameStates()
+    if err != nil {
+        log.Printf("Error loading saved games: %v", err)
+        return
+    }
+    for _, s := range saved {
+        if err := b.resumeGame(s); err != nil {
+            log.Printf("Error resuming game %d, dropping it: %v", s.GameID, err)
+            if err := b.DB.DeleteGameState(s.GameID); err != nil {
+                log.Printf("Error deleting state of game %d: %v", s.GameID, err)
+            }
+        }
+    }
+}
+
+func (b *Bot) resumeGame(saved db.SavedGame) error {
+    var state gameState
+    if err := json.Unmarshal([]byte(saved.State), &state); err != nil {
+        return fmt.Errorf("decoding state: %w", err)
+    }
+    game, err := b.DB.GetGame(saved.GameID)
+    if err != nil {
+        return fmt.Errorf("loading game: %w", err)
+    }
+    if !game.EndedAt.IsZero() {
+        return fmt.Errorf("game already ended")
+    }
+
+    var current *db.Question
+    if state.QuestionID != 0 {
+        current, err = b.DB.GetQuestion(state.QuestionID)
+        if err != nil {
+            log.Printf("Question %d of game %d is gone, waiting for the next one: %v", state.QuestionID, saved.GameID, err)
+            current = nil
+        }
+    }
+
+    t := NewTrivia(saved.GuildID, saved.ChannelID)
+    t.restore(saved, state, current)
+    if !b.Games.Start(t) {
+        return fmt.Errorf("channel %s already has a game", saved.ChannelID)
+    }
+
+    status := b.prefixed(saved.GuildID, "Admin, use `!!trivia next` for the next question.")
+    if t.Intermission > 0 {
+        status = "The next question is coming up."
+    }
+    if t.Status == statusOpen {
+        status = "Here is the current question again."
+    }
+    b.Transport.ChannelMessageSend(saved.ChannelID, fmt.Sprintf("Game #%d resumed after a bot restart. Scores so far are kept. %s", saved.GameID, status))
+    log.Printf("Resumed game %d in channel %s", saved.GameID, saved.ChannelID)
+
+    // The game's goroutine re-posts an open question
+    b.loops.Add(1)
+    go func() {
+        defer b.loops.Done()
+        b.runTrivia(t)
+    }()
+    return nil
+}
@@ -0,0 +1,220 @@
+package bot
+
+import (
+    "database/sql"
+    "errors"
+    "fmt"
+    "log"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/airylvat/trivia-bot/config"
+    "github.com/airylvat/trivia-bot/db"
+)
+
+// Observed correct rates that suggest each difficulty: at least easyRate
+// correct is easy, below hardRate is hard, and anything between is medium.
+const (
+    easyRate = 0.75
+    hardRate = 0.40
+)
+
+// calibrationMinAttempts is how many attempts a question needs before the
+// calibration report judges it, unless the admin gives another number.
+const calibrationMinAttempts = 10
+
+// observedDifficulty is the difficulty a correct rate suggests.
+func observedDifficulty(rate float64) int {
+    switch {
+    case rate >= easyRate:
+        return db.DifficultyEasy
+    case rate < hardRate:
+        return db.DifficultyHard
+    default:
+        return db.DifficultyMedium
+    }
+}
+
+// percent formats a fraction as a whole percentage.
+func percent(rate float64) string {
+    return fmt.Sprintf("%.0f%%", rate*100)
+}
+
+// handleQuestionStats shows how players have done on one question.
+func (b *Bot) handleQuestionStats(c *Context) {
+    id, err := strconv.Atoi(strings.TrimPrefix(c.Args, "#"))
+    if err != nil {
+        c.Reply(b.prefixed(c.GuildID, "Usage: `!!trivia qstats <question id>`"))
+        return
+    }
+    q, err := b.DB.GetQuestion(id)
+    if errors.Is(err, sql.ErrNoRows) {
+        c.Reply("No question with that ID.")
+        return
+    }
+    if err != nil {
+        c.Reply("Error fetching question.")
+        log.Printf("Question stats error: %v", err)
+        return
+    }
+    stats, err := b.DB.GetQuestionStats(id)
+    if err != nil {
+        c.Reply("Error fetching question statistics.")
+        log.Printf("Question stats error: %v", err)
+        return
+    }
+
+    var response strings.Builder
+    response.WriteString(fmt.Sprintf("**Question # %d Statistics**\n", q.ID))
+    response.WriteString(fmt.Sprintf("%s\nAnswer: ||%s||\n", q.Text, q.Answer))
+    response.WriteString(fmt.Sprintf("Category: %s | Difficulty: %s\n\n", valueOr(q.Category, "none"), db.DifficultyName(q.Difficulty)))
+    if stats.Attempts == 0 {
+        response.WriteString("Nobody has answered this question yet.")
+        c.Reply(response.String())
+        return
+    }
+
+    response.WriteString(fmt.Sprintf("Attempts: %d\n", stats.Attempts))
+    response.WriteString(fmt.Sprintf("Correct: %d (%s)\n", stats.Correct, percent(stats.CorrectRate())))
+    response.WriteString(fmt.Sprintf("Median answer time: %s\n", stats.MedianLatency.Round(100*time.Millisecond)))
+    if len(stats.WrongAnswers) > 0 {
+        response.WriteString("\n**Most Common Wrong Answers**\n")
+        for _, wrong := range stats.WrongAnswers {
+            response.WriteString(fmt.Sprintf("%s: %d\n", wrong.Answer, wrong.Count))
+        }
+    }
+    c.Reply(response.String())
+}
+
+// handleCalibrate suggests new difficulties for questions whose observed
+// correct rate doesn't match their rating.
+func (b *Bot) handleCalibrate(c *Context) {
+    minAttempts := calibrationMinAttempts
+    if c.Args != "" {
+        n, err := parseBounded("the minimum number of attempts", c.Args, 1, 10000)
+        if err != nil {
+            c.Reply(b.prefixed(c.GuildID, fmt.Sprintf("Error: %s. Usage: `!!trivia calibrate [minimum attempts]`", err)))
+            return
+        }
+        minAttempts = n
+    }
+
+    stats, err := b.DB.ListQuestionStats()
+    if err != nil {
+        c.Reply("Error fetching question statistics.")
+        log.Printf("Calibration error: %v", err)
+        return
+    }
+    questions, err := b.DB.ListQuestions()
+    if err != nil {
+        c.Reply("Error fetching questions.")
+        log.Printf("Calibration error: %v", err)
+        return
+    }
+    byID := make(map[int]db.Question, len(questions))
+    for _, q := range questions {
+        byID[q.ID] = q
+    }
+
+    var lines []string
+    judged := 0
+    for _, s := range stats {
+        q, ok := byID[s.QuestionID]
+        if !ok || s.Attempts < minAttempts {
+            continue // Removed, or too few attempts to judge
+        }
+        judged++
+        suggested := observedDifficulty(s.CorrectRate())
+        if suggested == q.Difficulty {
+            continue
+        }
+        lines = append(lines, fmt.Sprintf("#%d %s: %s → **%s** (%s correct over %d attempts)",
+            q.ID, q.Text, db.DifficultyName(q.Difficulty), db.DifficultyName(suggested), percent(s.CorrectRate()), s.Attempts))
+    }
+
+    if judged == 0 {
+        c.Reply(fmt.Sprintf("No questions have %d attempts yet, so there is nothing to calibrate.", minAttempts))
+        return
+    }
+    summary := fmt.Sprintf("%d questions have at least %d attempts.", judged, minAttempts)
+    if len(lines) == 0 {
+        c.Reply(summary + " Their difficulty ratings all match how often they are answered correctly.")
+        return
+    }
+
+    var response strings.Builder
+    response.WriteString("**Difficulty Calibration**\n")
+    response.WriteString(fmt.Sprintf("%s These %d look mis-rated (easy: %s correct or more, hard: under %s):\n\n",
+        summary, len(lines), percent(easyRate), percent(hardRate)))
+    for _, line := range lines {
+        line += "\n"
+        if response.Len()+len(line) > 1900 { // Reserve space for Discord's 2000-char limit
+            c.Send(response.String())
+            response.Reset()
+            response.WriteString("**Difficulty Calibration (continued)**\n\n")
+        }
+        response.WriteString(line)
+    }
+    response.WriteString(b.prefixed(c.GuildID, "\nChange a question's difficulty in the dashboard, or remove it and add it again with `!!trivia addq`."))
+    c.Reply(response.String())
+    log.Printf("Difficulty calibration requested by %s\n", c.Author.Username)
+}
+
+
+// userMention matches a user mention, with or without the nickname marker.
+var userMention = regexp.MustCompile(`^<@!?([0-9]+)>$`)
+
+// userArg returns the player a command names by mention or ID, or the
+// author if it names nobody.
+func userArg(c *Context) (string, bool) {
+    if c.Args == "" {
+        return c.Author.ID, true
+    }
+    userID := c.Args
+    if m := userMention.FindStringSubmatch(c.Args); m != nil {
+        userID = m[1]
+    }
+    return userID, config.IsID(userID)
+}
+
+// handleProfile shows a player's lifetime stats in this server, the
+// author's own unless another player is mentioned.
+func (b *Bot) handleProfile(c *Context) {
+    userID, ok := userArg(c)
+    if !ok {
+        c.Reply(b.prefixed(c.GuildID, "Usage: `!!trivia profile [@user]`"))
+        return
+    }
+
+    p, err := b.DB.GetProfile(c.GuildID, userID)
+    if err != nil {
+        c.Reply("Error fetching profile.")
+        log.Printf("Profile error: %v", err)
+        return
+    }
+    if p.Attempts == 0 && p.Games == 0 && p.Team == "" {
+        c.Reply(fmt.Sprintf("<@%s> hasn't played trivia in this server yet.", userID))
+        return
+    }
+
+    var response strings.Builder
+    response.WriteString("**Trivia Profile**\n")
+    response.WriteString(fmt.Sprintf("Player: <@%s>\n", userID))
+    response.WriteString(fmt.Sprintf("Team: %s\n", valueOr(p.Team, "none")))
+    response.WriteString(fmt.Sprintf("Points: %d\n", p.Points))
+    response.WriteString(fmt.Sprintf("Games played: %d | Wins: %d\n", p.Games, p.Wins))
+    if p.Attempts == 0 {
+        response.WriteString("No answers recorded yet.")
+        c.Reply(response.String())
+        return
+    }
+    response.WriteString(fmt.Sprintf("Correct answers: %d of %d (%s accuracy)\n", p.Correct, p.Attempts, percent(p.Accuracy())))
+    if p.Correct > 0 {
+        response.WriteString(fmt.Sprintf("Fastest correct answer: %s\n", p.Fastest.Round(100*time.Millisecond)))
+        response.WriteString(fmt.Sprintf("Longest streak: %d correct in a row\n", p.LongestStreak))
+    }
+    response.WriteString(fmt.Sprintf("Favorite category: %s\n", valueOr(p.FavoriteCategory, "none yet")))
+    c.Reply(response.String())
+}
@@ -0,0 +1,238 @@
+package bot
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/airylvat/trivia-bot/bank"
+    "github.com/airylvat/trivia-bot/db"
+)
+
+const (
+    maxImportSize    = 5 << 20 // Bytes
+    importExpiry     = 30 * time.Minute
+    previewRows      = 10
+    reportedProblems = 15
+)
+
+const importUsage = "Usage: attach a JSON or CSV file to `!!trivia import` to preview it, then `!!trivia import confirm` to save it or `!!trivia import cancel` to discard it. Use `!!trivia export` to get a file in the right format."
+
+// pendingImport is a previewed import waiting for `!!trivia import confirm`.
+type pendingImport struct {
+    questions []*db.Question
+    updates   int
+    expires   time.Time
+}
+
+// pendingImports holds one previewed import per admin per guild.
+type pendingImports struct {
+    byUser map[string]*pendingImport
+    mutex  sync.Mutex
+}
+
+func (p *pendingImports) put(key string, imp *pendingImport) {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+    if p.byUser == nil {
+        p.byUser = make(map[string]*pendingImport)
+    }
+    p.byUser[key] = imp
+}
+
+// take removes and returns the user's pending import if it hasn't expired.
+func (p *pendingImports) take(key string) *pendingImport {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+    imp, ok := p.byUser[key]
+    delete(p.byUser, key)
+    if !ok || time.Now().After(imp.expires) {
+        return nil
+    }
+    return imp
+}
+
+var downloadClient = &http.Client{Timeout: 30 * time.Second}
+
+// download fetches an attachment, refusing files over maxImportSize.
+func download(url string) ([]byte, error) {
+    resp, err := downloadClient.Get(url)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("download failed: %s", resp.Status)
+    }
+
+    data, err := io.ReadAll(io.LimitReader(resp.Body, maxImportSize+1))
+    if err != nil {
+        return nil, err
+    }
+    if len(data) > maxImportSize {
+        return nil, fmt.Errorf("file is larger than %d MB", maxImportSize>>20)
+    }
+    return data, nil
+}
+
+// shorten trims long question text for previews.
+func shorten(s string, max int) string {
+    runes := []rune(s)
+    if len(runes) <= max {
+        return s
+    }
+    return string(runes[:max-1]) + "…"
+}
+
+func (b *Bot) handleImport(c *Context) {
+    key := c.GuildID + "/" + c.Author.ID
+
+    switch strings.ToLower(c.Args) {
+    case "confirm":
+        imp := b.imports.take(key)
+        if imp == nil {
+            c.Reply(b.prefixed(c.GuildID, "You have no import waiting to be confirmed. Attach a file to `!!trivia import` first."))
+            return
+        }
+        if err := b.DB.ImportQuestions(imp.questions); err != nil {
+            c.Reply("Error importing questions. Nothing was saved.")
+            log.Printf("Import error: %v", err)
+            return
+        }
+        c.Reply(fmt.Sprintf("Imported %d questions (%d new, %d updated).", len(imp.questions), len(imp.questions)-imp.updates, imp.updates))
+        log.Printf("%d questions imported by %s\n", len(imp.questions), c.Author.Username)
+        return
+
+    case "cancel":
+        if b.imports.take(key) == nil {
+            c.Reply("You have no import waiting to be confirmed.")
+            return
+        }
+        c.Reply("Import discarded. Nothing was saved.")
+        return
+
+    case "":
+        // Preview the attached file below
+    default:
+        c.Reply(b.prefixed(c.GuildID, importUsage))
+        return
+    }
+
+    if len(c.Attachments) == 0 {
+        c.Reply(b.prefixed(c.GuildID, importUsage))
+        return
+    }
+
+    attachment := c.Attachments[0]
+    format, err := bank.FormatFromName(attachment.Filename)
+    if err != nil {
+        c.Reply("Error: " + err.Error())
+        return
+    }
+    if attachment.Size > maxImportSize {
+        c.Reply(fmt.Sprintf("Error: the file is larger than %d MB.", maxImportSize>>20))
+        return
+    }
+
+    data, err := download(attachment.URL)
+    if err != nil {
+        c.Reply("Error downloading the file.")
+        log.Printf("Import download error: %v", err)
+        return
+    }
+
+    rows, err := bank.Parse(bytes.NewReader(data), format)
+    if err != nil {
+        c.Reply("Error: " + err.Error())
+        return
+    }
+
+    var valid []*db.Question
+    var problems, preview []string
+    updates := 0
+    for _, row := range rows {
+        if row.Err != nil {
+            problems = append(problems, fmt.Sprintf("Row %d: %v", row.Line, row.Err))
+            continue
+        }
+
+        q := row.Question
+        action := "new"
+        if q.ID != 0 {
+            if _, err := b.DB.GetQuestion(q.ID); err == nil {
+                action = fmt.Sprintf("updates #%d", q.ID)
+                updates++
+            } else {
+                action = fmt.Sprintf("new #%d", q.ID)
+            }
+        }
+        valid = append(valid, q)
+        preview = append(preview, fmt.Sprintf("Row %d (%s): %s → ||%s|| [%s, %s]", row.Line, action, shorten(q.Text, 80), shorten(q.Answer, 40), valueOr(q.Category, "no category"), db.DifficultyName(q.Difficulty)))
+    }
+
+    footer := "\nNothing to import."
+    if len(valid) > 0 {
+        b.imports.put(key, &pendingImport{questions: valid, updates: updates, expires: time.Now().Add(importExpiry)})
+        footer = b.prefixed(c.GuildID, fmt.Sprintf("\nUse `!!trivia import confirm` within %d minutes to save the %d valid rows, or `!!trivia import cancel` to discard them.", int(importExpiry.Minutes()), len(valid)))
+    }
+
+    var report strings.Builder
+    report.WriteString(fmt.Sprintf("**Import preview for %s** (nothing saved yet)\n", attachment.Filename))
+    report.WriteString(fmt.Sprintf("Rows: %d | Valid: %d | Invalid: %d | New: %d | Updates: %d\n", len(rows), len(valid), len(problems), len(valid)-updates, updates))
+
+    // writeLines adds up to max lines, stopping early so the footer still
+    // fits in one message
+    writeLines := func(title string, lines []string, max int) {
+        if len(lines) == 0 {
+            return
+        }
+        report.WriteString(title)
+        for i, line := range lines {
+            more := fmt.Sprintf("...and %d more\n", len(lines)-i)
+            if i == max || report.Len()+len(line)+1+len(more)+len(footer) > 1900 { // Reserve space for Discord's 2000-char limit
+                report.WriteString(more)
+                return
+            }
+            report.WriteString(line + "\n")
+        }
+    }
+    writeLines("\n**Problems** (these rows will be skipped)\n", problems, reportedProblems)
+    writeLines("\n**Preview**\n", preview, previewRows)
+    report.WriteString(footer)
+
+    c.Reply(report.String())
+    log.Printf("Import of %s previewed by %s: %d valid, %d invalid\n", attachment.Filename, c.Author.Username, len(valid), len(problems))
+}
+
+func (b *Bot) handleExport(c *Context) {
+    format := strings.ToLower(c.Args)
+    if format == "" {
+        format = bank.FormatJSON
+    }
+    if format != bank.FormatJSON && format != bank.FormatCSV {
+        c.Reply(b.prefixed(c.GuildID, "Usage: `!!trivia export [json|csv]`"))
+        return
+    }
+
+    questions, err := b.DB.ListQuestions()
+    if err != nil {
+        c.Reply("Error fetching questions.")
+        log.Printf("Export error: %v", err)
+        return
+    }
+
+    var buf bytes.Buffer
+    if err := bank.Export(&buf, format, questions); err != nil {
+        c.Reply("Error exporting questions.")
+        log.Printf("Export error: %v", err)
+        return
+    }
+
+    c.ReplyFile(fmt.Sprintf("Exported %d questions.", len(questions)), "trivia-questions."+format, &buf)
+    log.Printf("Questions exported as %s by %s\n", format, c.Author.Username)
+}
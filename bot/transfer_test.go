@@ -0,0 +1,42 @@
+package bot
+
+import (
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/bwmarrin/discordgo"
+)
+
+func TestImportPreviewFitsOneMessage(t *testing.T) {
+    var csv strings.Builder
+    csv.WriteString("text,answer,category\n")
+    for i := 0; i < 40; i++ {
+        csv.WriteString(fmt.Sprintf("Broken question %d,,\n", i))
+        csv.WriteString(fmt.Sprintf("%s %d?,%s,%s\n", strings.Repeat("Long question ", 10), i, strings.Repeat("answer ", 10), strings.Repeat("c", 30)))
+    }
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        fmt.Fprint(w, csv.String())
+    }))
+    defer server.Close()
+
+    b, fake := newTestBot(t)
+    b.HandleMessage(&discordgo.MessageCreate{Message: &discordgo.Message{
+        ID:          fmt.Sprint(messageIDs.Add(1)),
+        ChannelID:   testChannel,
+        GuildID:     testGuild,
+        Content:     "!!trivia import",
+        Author:      &discordgo.User{ID: testAdmin, Username: "admin"},
+        Attachments: []*discordgo.MessageAttachment{{Filename: "questions.csv", URL: server.URL, Size: csv.Len()}},
+    }})
+
+    report := expect(t, fake, "**Import preview for questions.csv**")
+    if len(report.Content) > 2000 {
+        t.Errorf("the preview is %d characters, over Discord's limit", len(report.Content))
+    }
+    if !strings.Contains(report.Content, "Use `!!trivia import confirm` within") {
+        t.Errorf("the preview has no confirm instructions:\n%s", report.Content)
+    }
+}
@@ -0,0 +1,81 @@
+package bot
+
+import (
+    "github.com/airylvat/trivia-bot/metrics"
+
+    "github.com/bwmarrin/discordgo"
+)
+
+// Transport is everything the bot sends to or looks up from Discord. Game
+// logic and command handlers only go through a Transport, so they can run
+// against FakeTransport without a live session.
+type Transport interface {
+    ChannelMessageSend(channelID, content string) (*discordgo.Message, error)
+    ChannelMessageSendReply(channelID, content string, reference *discordgo.MessageReference) (*discordgo.Message, error)
+    ChannelMessageSendEmbed(channelID string, embed *discordgo.MessageEmbed) (*discordgo.Message, error)
+    ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend) (*discordgo.Message, error)
+    ChannelMessageEditComplex(edit *discordgo.MessageEdit) (*discordgo.Message, error)
+    InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse) error
+    FollowupMessageCreate(interaction *discordgo.Interaction, wait bool, data *discordgo.WebhookParams) (*discordgo.Message, error)
+    GuildMember(guildID, userID string) (*discordgo.Member, error)
+    UserChannelCreate(userID string) (*discordgo.Channel, error) // Opens a direct message channel
+}
+
+// sendFailed counts a failed send in the metrics and returns err unchanged.
+func sendFailed(call string, err error) error {
+    if err != nil {
+        metrics.SendErrors.WithLabelValues(call).Inc()
+    }
+    return err
+}
+
+// discordTransport is the default Transport, backed by a discordgo session.
+type discordTransport struct {
+    session *discordgo.Session
+}
+
+func NewDiscordTransport(s *discordgo.Session) Transport {
+    return &discordTransport{session: s}
+}
+
+func (d *discordTransport) ChannelMessageSend(channelID, content string) (*discordgo.Message, error) {
+    msg, err := d.session.ChannelMessageSend(channelID, content)
+    return msg, sendFailed("ChannelMessageSend", err)
+}
+
+func (d *discordTransport) ChannelMessageSendReply(channelID, content string, reference *discordgo.MessageReference) (*discordgo.Message, error) {
+    msg, err := d.session.ChannelMessageSendReply(channelID, content, reference)
+    return msg, sendFailed("ChannelMessageSendReply", err)
+}
+
+func (d *discordTransport) ChannelMessageSendEmbed(channelID string, embed *discordgo.MessageEmbed) (*discordgo.Message, error) {
+    msg, err := d.session.ChannelMessageSendEmbed(channelID, embed)
+    return msg, sendFailed("ChannelMessageSendEmbed", err)
+}
+
+func (d *discordTransport) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend) (*discordgo.Message, error) {
+    msg, err := d.session.ChannelMessageSendComplex(channelID, data)
+    return msg, sendFailed("ChannelMessageSendComplex", err)
+}
+
+func (d *discordTransport) ChannelMessageEditComplex(edit *discordgo.MessageEdit) (*discordgo.Message, error) {
+    msg, err := d.session.ChannelMessageEditComplex(edit)
+    return msg, sendFailed("ChannelMessageEditComplex", err)
+}
+
+func (d *discordTransport) InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse) error {
+    return sendFailed("InteractionRespond", d.session.InteractionRespond(interaction, resp))
+}
+
+func (d *discordTransport) FollowupMessageCreate(interaction *discordgo.Interaction, wait bool, data *discordgo.WebhookParams) (*discordgo.Message, error) {
+    msg, err := d.session.FollowupMessageCreate(interaction, wait, data)
+    return msg, sendFailed("FollowupMessageCreate", err)
+}
+
+func (d *discordTransport) GuildMember(guildID, userID string) (*discordgo.Member, error) {
+    return d.session.GuildMember(guildID, userID)
+}
+
+func (d *discordTransport) UserChannelCreate(userID string) (*discordgo.Channel, error) {
+    return d.session.UserChannelCreate(userID)
+}
@@ -1,44 +1,342 @@
 package bot
 
 import (
+    "errors"
+    "fmt"
+    "math/rand"
     "sync"
     "time"
     "github.com/airylvat/trivia-bot/db"
 )
 
+// gameStatus is where a game is in its life. It only changes through
+// transition, which refuses moves the game can't make.
+type gameStatus int
+
+const (
+    statusLobby  gameStatus = iota // Started, no question posted yet
+    statusOpen                     // The current question is taking answers
+    statusClosed                   // Between questions
+    statusPaused                   // Saved and stopped so the bot can restart
+    statusEnded
+)
+
+var statusNames = []string{"lobby", "open", "closed", "paused", "ended"}
+
+func (s gameStatus) String() string {
+    if s < 0 || int(s) >= len(statusNames) {
+        return fmt.Sprintf("status(%d)", int(s))
+    }
+    return statusNames[s]
+}
+
+// transitions lists the statuses each status can move to. Paused and ended
+// games stop; a paused game resumes as a new Trivia after the restart.
+var transitions = map[gameStatus][]gameStatus{
+    statusLobby:  {statusOpen, statusPaused, statusEnded},
+    statusOpen:   {statusClosed, statusPaused, statusEnded},
+    statusClosed: {statusOpen, statusPaused, statusEnded},
+}
+
+// Trivia is one channel's game. Once running, all of its state belongs to
+// the goroutine running Bot.runTrivia. Other goroutines only call its
+// exported methods, which send that goroutine commands (see engine.go), and
+// may read GuildID and ChannelID.
 type Trivia struct {
-    Active         bool
+    GameID         int // Recorded game session
+    GuildID        string
+    ChannelID      string
+    Filter         db.QuestionFilter // Limits which questions the game asks
+    QuestionTime   time.Duration     // Time limit per question, 0 for none
+    Intermission   time.Duration     // Pause before automatically posting the next question, 0 to wait for `next`
+    QuestionLimit  int               // Questions in the game, 0 for no limit
+    Asked          int               // Questions posted so far
+    Scoring        ScoringRule
+    BasePoints     int  // Points a correct answer is worth before the scoring rule
+    PartialCredit  bool // Also reward the 2nd and 3rd correct answers
+    IdleTimeout    time.Duration // The game ends after this long without activity
+    Status         gameStatus
     Current        *db.Question
     StartTime      time.Time
-    NextChan       chan struct{}
-    AnsweredCorrect bool // New field to track if question is answered
-    Mutex          sync.Mutex
+    Deadline       time.Time // When the current question's timer runs out
+    AnsweredCorrect bool
+    Awards         []Award // Correct answers to the current question, in order
+
+    // Multiple-choice state for the current question
+    Options        []string       // Answer and distractors in the order shown
+    CorrectOption  int            // Index of the answer in Options
+    Picks          map[string]int // Each player's first pick, by user ID
+    MessageID      string         // Message holding the answer buttons
+
+    commands      chan gameCommand
+    done          chan struct{}    // Closed when runTrivia returns
+    questionTimer <-chan time.Time // Fires when the open question's time is up
+    advanceTimer  <-chan time.Time // Fires when the intermission is over
+
+    // Loaded on the first correct answer, see checkAchievements
+    achievements []db.Achievement
+    unlocked     map[string]map[string]bool // Achievement keys each player has, by user ID
 }
 
-func NewTrivia() *Trivia {
+// Award is a scored correct answer.
+type Award struct {
+    UserID  string
+    Rank    int // 1 for the first correct answer
+    Points  int
+    Elapsed time.Duration // Time since the question was posted
+}
+
+// QuestionResult describes a question when it closes.
+type QuestionResult struct {
+    Question        *db.Question
+    AnsweredCorrect bool
+    Awards          []Award
+    Tally           *ChoiceTally // Set for multiple-choice questions
+}
+
+// ChoiceTally is the final result of a multiple-choice question.
+type ChoiceTally struct {
+    Options      []string
+    Correct      int
+    Counts       []int
+    MessageID    string
+}
+
+func NewTrivia(guildID, channelID string) *Trivia {
     return &Trivia{
-        NextChan: make(chan struct{}),
+        GuildID:     guildID,
+        ChannelID:   channelID,
+        Scoring:     classicScoring{},
+        BasePoints:  basePoints,
+        IdleTimeout: defaultIdleTimeout,
+        commands:    make(chan gameCommand),
+        done:        make(chan struct{}),
     }
 }
 
-func (t *Trivia) Start() {
-    t.Mutex.Lock()
-    t.Active = true
-    t.Mutex.Unlock()
+// transition moves the game to a new status.
+func (t *Trivia) transition(to gameStatus) error {
+    for _, allowed := range transitions[t.Status] {
+        if allowed == to {
+            t.Status = to
+            return nil
+        }
+    }
+    return fmt.Errorf("game %d can't go from %s to %s", t.GameID, t.Status, to)
 }
 
-func (t *Trivia) End() {
-    t.Mutex.Lock()
-    t.Active = false
-    t.Current = nil
-    t.AnsweredCorrect = false
-    t.Mutex.Unlock()
+// running reports whether the game is still going.
+func (t *Trivia) running() bool {
+    return t.Status != statusPaused && t.Status != statusEnded
 }
 
-func (t *Trivia) SetQuestion(q *db.Question) {
-    t.Mutex.Lock()
+// setQuestion opens a new question.
+func (t *Trivia) setQuestion(q *db.Question) error {
+    if err := t.transition(statusOpen); err != nil {
+        return err
+    }
     t.Current = q
     t.StartTime = time.Now()
+    t.Deadline = time.Time{}
+    if t.QuestionTime > 0 {
+        t.Deadline = t.StartTime.Add(t.QuestionTime)
+    }
+    t.Asked++
     t.AnsweredCorrect = false // Reset for new question
-    t.Mutex.Unlock()
+    t.Options = nil
+    t.CorrectOption = 0
+    t.Picks = nil
+    t.Awards = nil
+    t.MessageID = ""
+
+    if q.IsChoice() {
+        t.Options = append([]string{q.Answer}, q.Distractors...)
+        rand.Shuffle(len(t.Options), func(i, j int) {
+            t.Options[i], t.Options[j] = t.Options[j], t.Options[i]
+        })
+        for i, option := range t.Options {
+            if option == q.Answer {
+                t.CorrectOption = i
+                break
+            }
+        }
+        t.Picks = make(map[string]int)
+    }
+    return nil
+}
+
+// maxAwards is how many correct answers score per question.
+func (t *Trivia) maxAwards() int {
+    if t.PartialCredit {
+        return len(partialShares)
+    }
+    return 1
+}
+
+// award scores the next correct answer to the open question.
+func (t *Trivia) award(userID string) (Award, bool) {
+    if len(t.Awards) >= t.maxAwards() {
+        return Award{}, false
+    }
+    for _, a := range t.Awards {
+        if a.UserID == userID {
+            return Award{}, false
+        }
+    }
+
+    rank := len(t.Awards) + 1
+    elapsed := time.Since(t.StartTime)
+    points := t.Scoring.Points(ScoreContext{
+        BasePoints: t.BasePoints,
+        Elapsed:    elapsed,
+        TimeLimit:  t.QuestionTime,
+        Difficulty: t.Current.Difficulty,
+    })
+    a := Award{UserID: userID, Rank: rank, Points: partialPoints(points, rank), Elapsed: elapsed}
+    t.Awards = append(t.Awards, a)
+    t.AnsweredCorrect = true
+    return a, true
+}
+
+// Reasons an answer or pick is refused
+var (
+    errNoQuestion      = errors.New("no question is open")
+    errQuestionClosed  = errors.New("the question is closed")
+    errWrongQuestion   = errors.New("not the current question")
+    errChoiceQuestion  = errors.New("the question is multiple choice")
+    errAlreadyPicked   = errors.New("already picked")
+    errAlreadyAnswered = errors.New("already answered")
+)
+
+// checkOpen reports why the game can't take an answer right now, if it can't.
+func (t *Trivia) checkOpen() error {
+    switch {
+    case t.Status == statusOpen:
+        return nil
+    case t.Current == nil:
+        return errNoQuestion
+    case t.AnsweredCorrect:
+        return errAlreadyAnswered
+    default:
+        return errQuestionClosed
+    }
+}
+
+// recordPick records a player's button click on the open multiple-choice
+// question. Only a player's first pick counts. A correct pick that scores
+// returns its award.
+func (t *Trivia) recordPick(questionID int, userID string, option int) (correct bool, award *Award, err error) {
+    if err := t.checkOpen(); err != nil {
+        return false, nil, err
+    }
+    if t.Current.ID != questionID || t.Picks == nil || option < 0 || option >= len(t.Options) {
+        return false, nil, errWrongQuestion
+    }
+    if _, picked := t.Picks[userID]; picked {
+        return false, nil, errAlreadyPicked
+    }
+
+    t.Picks[userID] = option
+    if option != t.CorrectOption {
+        return false, nil, nil
+    }
+    if a, ok := t.award(userID); ok {
+        return true, &a, nil
+    }
+    return true, nil, nil
+}
+
+// closeQuestion stops accepting answers for the open question and returns
+// how it went, or nil if no question is open.
+func (t *Trivia) closeQuestion() (*QuestionResult, error) {
+    if t.Status != statusOpen {
+        return nil, nil
+    }
+    if err := t.transition(statusClosed); err != nil {
+        return nil, err
+    }
+    t.questionTimer = nil
+
+    result := &QuestionResult{Question: t.Current, AnsweredCorrect: t.AnsweredCorrect, Awards: t.Awards}
+    if t.Picks != nil {
+        counts := make([]int, len(t.Options))
+        for _, option := range t.Picks {
+            counts[option]++
+        }
+        result.Tally = &ChoiceTally{
+            Options:      t.Options,
+            Correct:      t.CorrectOption,
+            Counts:       counts,
+            MessageID:    t.MessageID,
+        }
+    }
+    return result, nil
+}
+
+// finished reports whether the game has asked all its questions.
+func (t *Trivia) finished() bool {
+    return t.QuestionLimit > 0 && t.Asked >= t.QuestionLimit
+}
+
+// Games is a registry of running trivia games keyed by guild and channel, so
+// several channels and servers can each run their own game at the same time.
+type Games struct {
+    games map[string]*Trivia
+    Mutex sync.Mutex
+}
+
+func NewGames() *Games {
+    return &Games{
+        games: make(map[string]*Trivia),
+    }
+}
+
+func gameKey(guildID, channelID string) string {
+    return guildID + "/" + channelID
+}
+
+// Get returns the game running in a channel, or nil if there is none.
+func (g *Games) Get(guildID, channelID string) *Trivia {
+    g.Mutex.Lock()
+    defer g.Mutex.Unlock()
+    return g.games[gameKey(guildID, channelID)]
+}
+
+// Start registers a new game for its channel. It returns false if the
+// channel already has one.
+func (g *Games) Start(t *Trivia) bool {
+    g.Mutex.Lock()
+    defer g.Mutex.Unlock()
+
+    key := gameKey(t.GuildID, t.ChannelID)
+    if _, ok := g.games[key]; ok {
+        return false
+    }
+    g.games[key] = t
+    return true
+}
+
+// remove unregisters a game that has stopped.
+func (g *Games) remove(t *Trivia) {
+    g.Mutex.Lock()
+    defer g.Mutex.Unlock()
+
+    key := gameKey(t.GuildID, t.ChannelID)
+    if g.games[key] == t {
+        delete(g.games, key)
+    }
+}
+
+// Active returns every running game, optionally limited to one guild.
+func (g *Games) Active(guildID string) []*Trivia {
+    g.Mutex.Lock()
+    defer g.Mutex.Unlock()
+
+    var active []*Trivia
+    for _, t := range g.games {
+        if guildID == "" || t.GuildID == guildID {
+            active = append(active, t)
+        }
+    }
+    return active
 }
@@ -0,0 +1,346 @@
+package config
+
+import (
+    "errors"
+    "fmt"
+    "io/fs"
+    "net"
+    "net/url"
+    "os"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/airylvat/trivia-bot/answer"
+
+    "github.com/joho/godotenv"
+    "gopkg.in/yaml.v3"
+)
+
+// Config is the bot's settings, loaded once at startup.
+type Config struct {
+    Token           string
+    AdminIDs        []string // Users who can run admin commands
+    AdminRoleIDs    []string // Roles whose members can run admin commands
+    AllowedChannels []string // Channels the bot answers in
+    DefaultGuildID  string   // Guild given scores from before per-guild scoring
+    AnswerTolerance answer.Tolerance
+    Storage         string // "sqlite" or "memory"
+    DatabasePath    string
+    APIAddress      string // Where the HTTP API listens, e.g. ":8080"; empty disables it
+    PublicURL       string // Where users reach the API, for dashboard login links
+    MetricsAddress  string // Where Prometheus metrics are served, e.g. ":9100"; empty disables them
+    DrainTimeout    time.Duration // How long shutdown waits for commands and games to finish
+
+    File    string            // Config file that was read, if any
+    sources map[string]string // Where each key's value came from
+}
+
+// Keys are the settings that can be given as environment variables, in .env
+// or (lowercased) in the config file.
+var Keys = []string{
+    "DISCORD_TOKEN",
+    "ADMIN_IDS",
+    "ADMIN_ROLE_IDS",
+    "ALLOWED_CHANNELS",
+    "DEFAULT_GUILD_ID",
+    "ANSWER_TOLERANCE",
+    "STORAGE",
+    "DATABASE_PATH",
+    "API_ADDRESS",
+    "PUBLIC_URL",
+    "METRICS_ADDRESS",
+    "DRAIN_TIMEOUT",
+
+    // Single-ID forms from before multiple admins were supported
+    "ADMIN_ID",
+    "ADMIN_ROLE_ID",
+}
+
+var defaults = map[string]string{
+    "STORAGE":       "sqlite",
+    "DATABASE_PATH": "./trivia.db",
+    "DRAIN_TIMEOUT": "8s", // Inside Docker's default 10 second stop grace period
+}
+
+const defaultConfigFile = "trivia.yaml"
+
+// snowflake matches a Discord ID.
+var snowflake = regexp.MustCompile(`^[0-9]{17,20}$`)
+
+// IsID reports whether s looks like a Discord ID.
+func IsID(s string) bool {
+    return snowflake.MatchString(s)
+}
+
+// layer is one source of settings, keyed like environment variables.
+type layer struct {
+    name   string
+    values map[string]string
+}
+
+// Load reads the settings from, in order of precedence, the environment,
+// .env, the config file and the defaults. The config file is CONFIG_FILE, or
+// trivia.yaml if it exists. Every problem found is reported, not just the first.
+func Load() (*Config, error) {
+    env := layer{name: "environment", values: make(map[string]string)}
+    for _, key := range append([]string{"CONFIG_FILE"}, Keys...) {
+        if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+            env.values[key] = value
+        }
+    }
+
+    dotenv := layer{name: ".env"}
+    values, err := godotenv.Read()
+    if err != nil && !errors.Is(err, fs.ErrNotExist) {
+        return nil, fmt.Errorf("reading .env: %w", err)
+    }
+    dotenv.values = values
+
+    layers := []layer{env, dotenv}
+    file, _ := lookup(layers, "CONFIG_FILE")
+    explicit := file != ""
+    if !explicit {
+        file = defaultConfigFile
+    }
+    fileValues, err := readFile(file)
+    if errors.Is(err, fs.ErrNotExist) && !explicit {
+        file = ""
+    } else if err != nil {
+        return nil, fmt.Errorf("reading config file %s: %w", file, err)
+    } else {
+        layers = append(layers, layer{name: file, values: fileValues})
+    }
+    layers = append(layers, layer{name: "default", values: defaults})
+
+    c := &Config{File: file, sources: make(map[string]string)}
+    get := func(key string) string {
+        value, source := lookup(layers, key)
+        if source != "" {
+            c.sources[key] = source
+        }
+        return value
+    }
+
+    var problems []error
+    ids := func(keys ...string) []string {
+        var list []string
+        for _, key := range keys {
+            for _, id := range splitList(get(key)) {
+                if !IsID(id) {
+                    problems = append(problems, fmt.Errorf("%s: %q is not a Discord ID (expected 17 to 20 digits)", key, id))
+                    continue
+                }
+                list = appendUnique(list, id)
+            }
+        }
+        return list
+    }
+
+    c.Token = get("DISCORD_TOKEN")
+    c.AdminIDs = ids("ADMIN_IDS", "ADMIN_ID")
+    c.AdminRoleIDs = ids("ADMIN_ROLE_IDS", "ADMIN_ROLE_ID")
+    c.AllowedChannels = ids("ALLOWED_CHANNELS")
+    if guilds := ids("DEFAULT_GUILD_ID"); len(guilds) > 1 {
+        problems = append(problems, fmt.Errorf("DEFAULT_GUILD_ID: expected one ID, got %d", len(guilds)))
+    } else if len(guilds) == 1 {
+        c.DefaultGuildID = guilds[0]
+    }
+
+    c.AnswerTolerance, err = answer.ParseTolerance(get("ANSWER_TOLERANCE"))
+    if err != nil {
+        problems = append(problems, fmt.Errorf("ANSWER_TOLERANCE: %w", err))
+    }
+
+    c.Storage = strings.ToLower(get("STORAGE"))
+    if c.Storage != "sqlite" && c.Storage != "memory" {
+        problems = append(problems, fmt.Errorf("STORAGE: %q is not a storage backend (expected sqlite or memory)", c.Storage))
+    }
+    c.DatabasePath = get("DATABASE_PATH")
+    c.APIAddress = get("API_ADDRESS")
+    c.PublicURL = strings.TrimSuffix(get("PUBLIC_URL"), "/")
+    if c.APIAddress != "" {
+        if host, port, err := net.SplitHostPort(c.APIAddress); err != nil {
+            problems = append(problems, fmt.Errorf("API_ADDRESS: %q is not a host:port address (e.g. :8080)", c.APIAddress))
+        } else if c.PublicURL == "" {
+            if host == "" {
+                host = "localhost"
+            }
+            c.PublicURL = "http://" + net.JoinHostPort(host, port)
+        }
+    }
+    c.MetricsAddress = get("METRICS_ADDRESS")
+    if _, _, err := net.SplitHostPort(c.MetricsAddress); c.MetricsAddress != "" && err != nil {
+        problems = append(problems, fmt.Errorf("METRICS_ADDRESS: %q is not a host:port address (e.g. :9100)", c.MetricsAddress))
+    }
+    c.DrainTimeout, err = parseDuration(get("DRAIN_TIMEOUT"))
+    if err != nil {
+        problems = append(problems, fmt.Errorf("DRAIN_TIMEOUT: %w", err))
+    }
+    if c.PublicURL != "" {
+        if u, err := url.Parse(c.PublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+            problems = append(problems, fmt.Errorf("PUBLIC_URL: %q is not an http or https URL", c.PublicURL))
+        }
+    }
+
+    if len(problems) > 0 {
+        return nil, fmt.Errorf("invalid configuration:\n%w", errors.Join(problems...))
+    }
+    return c, nil
+}
+
+// readFile reads a YAML config file into environment-style keys. Lists
+// become comma-separated values.
+func readFile(path string) (map[string]string, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    var raw map[string]interface{}
+    if err := yaml.Unmarshal(data, &raw); err != nil {
+        return nil, err
+    }
+
+    values := make(map[string]string, len(raw))
+    for name, value := range raw {
+        key := strings.ToUpper(name)
+        if !known(key) {
+            return nil, fmt.Errorf("unknown setting %q", name)
+        }
+        switch v := value.(type) {
+        case nil:
+        case []interface{}:
+            var items []string
+            for _, item := range v {
+                items = append(items, fmt.Sprint(item))
+            }
+            values[key] = strings.Join(items, ",")
+        case map[string]interface{}:
+            return nil, fmt.Errorf("setting %q must be a value or a list", name)
+        default:
+            values[key] = fmt.Sprint(v)
+        }
+    }
+    return values, nil
+}
+
+// parseDuration reads a duration such as "8s" or "1m30s". A plain number
+// is taken as seconds.
+func parseDuration(s string) (time.Duration, error) {
+    if seconds, err := strconv.Atoi(s); err == nil {
+        s = strconv.Itoa(seconds) + "s"
+    }
+    d, err := time.ParseDuration(s)
+    if err != nil || d < 0 {
+        return 0, fmt.Errorf("%q is not a duration (e.g. 8s or 1m)", s)
+    }
+    return d, nil
+}
+
+// lookup returns the first value for key in the layers and the name of the
+// layer it came from. Empty values count as unset.
+func lookup(layers []layer, key string) (value, source string) {
+    for _, l := range layers {
+        if value := strings.TrimSpace(l.values[key]); value != "" {
+            return value, l.name
+        }
+    }
+    return "", ""
+}
+
+func known(key string) bool {
+    for _, k := range Keys {
+        if k == key {
+            return true
+        }
+    }
+    return false
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(s string) []string {
+    var list []string
+    for _, item := range strings.Split(s, ",") {
+        if item = strings.TrimSpace(item); item != "" {
+            list = append(list, item)
+        }
+    }
+    return list
+}
+
+func appendUnique(list []string, item string) []string {
+    for _, existing := range list {
+        if existing == item {
+            return list
+        }
+    }
+    return append(list, item)
+}
+
+// Diagnostics describes the loaded settings and where they came from, for
+// logging at startup. The token is never included.
+func (c *Config) Diagnostics() []string {
+    file := c.File
+    if file == "" {
+        file = "none"
+    }
+    token := "not set"
+    if c.Token != "" {
+        token = fmt.Sprintf("set (%d characters, redacted)", len(c.Token))
+    }
+
+    lines := []string{
+        "Config file: " + file,
+        c.describe("DISCORD_TOKEN", token),
+        c.describe("ADMIN_IDS", listOrNone(c.AdminIDs), "ADMIN_ID"),
+        c.describe("ADMIN_ROLE_IDS", listOrNone(c.AdminRoleIDs), "ADMIN_ROLE_ID"),
+        c.describe("ALLOWED_CHANNELS", listOrNone(c.AllowedChannels)),
+        c.describe("DEFAULT_GUILD_ID", valueOrNone(c.DefaultGuildID)),
+        c.describe("ANSWER_TOLERANCE", c.AnswerTolerance.String()),
+        c.describe("STORAGE", c.Storage),
+        c.describe("DATABASE_PATH", c.DatabasePath),
+        c.describe("API_ADDRESS", valueOr(c.APIAddress, "disabled")),
+        c.describe("PUBLIC_URL", valueOrNone(c.PublicURL)),
+        c.describe("METRICS_ADDRESS", valueOr(c.MetricsAddress, "disabled")),
+        c.describe("DRAIN_TIMEOUT", c.DrainTimeout.String()),
+    }
+    if len(c.AdminIDs) == 0 && len(c.AdminRoleIDs) == 0 {
+        lines = append(lines, "Warning: no ADMIN_IDS or ADMIN_ROLE_IDS are set, so nobody can run admin commands")
+    }
+    if len(c.AllowedChannels) == 0 {
+        lines = append(lines, "Warning: ALLOWED_CHANNELS is empty, so the bot ignores commands until a server sets allowed_channels")
+    }
+    return lines
+}
+
+// describe formats one setting with the sources it was read from.
+func (c *Config) describe(key, value string, aliases ...string) string {
+    var sources []string
+    for _, k := range append([]string{key}, aliases...) {
+        if source, ok := c.sources[k]; ok {
+            sources = appendUnique(sources, source)
+        }
+    }
+    sort.Strings(sources)
+    if len(sources) == 0 {
+        return fmt.Sprintf("%s: %s", key, value)
+    }
+    return fmt.Sprintf("%s: %s (from %s)", key, value, strings.Join(sources, ", "))
+}
+
+func listOrNone(list []string) string {
+    return valueOrNone(strings.Join(list, ", "))
+}
+
+func valueOrNone(s string) string {
+    return valueOr(s, "none")
+}
+
+func valueOr(s, fallback string) string {
+    if s == "" {
+        return fallback
+    }
+    return s
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+    "database/sql"
+    "time"
+)
+
+// ListAchievements returns every achievement, ordered by key.
+func (db *DB) ListAchievements() ([]Achievement, error) {
+    rows, err := db.Query("SELECT key, name, description, metric, threshold FROM achievements ORDER BY key")
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var achievements []Achievement
+    for rows.Next() {
+        var a Achievement
+        if err := rows.Scan(&a.Key, &a.Name, &a.Description, &a.Metric, &a.Threshold); err != nil {
+            return nil, err
+        }
+        achievements = append(achievements, a)
+    }
+    return achievements, rows.Err()
+}
+
+func (db *DB) AddAchievement(a *Achievement) error {
+    _, err := db.Exec("INSERT INTO achievements (key, name, description, metric, threshold) VALUES (?, ?, ?, ?, ?)",
+        a.Key, a.Name, a.Description, a.Metric, a.Threshold)
+    return err
+}
+
+// RemoveAchievement deletes an achievement and every unlock of it. It
+// returns sql.ErrNoRows if there is no such achievement.
+func (db *DB) RemoveAchievement(key string) error {
+    tx, err := db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.Exec("DELETE FROM user_achievements WHERE achievement = ?", key); err != nil {
+        return err
+    }
+    res, err := tx.Exec("DELETE FROM achievements WHERE key = ?", key)
+    if err != nil {
+        return err
+    }
+    if n, err := res.RowsAffected(); err != nil {
+        return err
+    } else if n == 0 {
+        return sql.ErrNoRows
+    }
+    return tx.Commit()
+}
+
+// UnlockAchievement records that a player earned an achievement during a
+// game. It reports false if they already had it.
+func (db *DB) UnlockAchievement(guildID, userID, key string, gameID int) (bool, error) {
+    res, err := db.Exec("INSERT OR IGNORE INTO user_achievements (guild_id, user_id, achievement, game_id, unlocked_at) VALUES (?, ?, ?, ?, ?)",
+        guildID, userID, key, gameID, time.Now().UTC())
+    if err != nil {
+        return false, err
+    }
+    n, err := res.RowsAffected()
+    return n > 0, err
+}
+
+// ListUserAchievements returns the achievements a player has unlocked in a
+// guild, oldest first.
+func (db *DB) ListUserAchievements(guildID, userID string) ([]UserAchievement, error) {
+    rows, err := db.Query(`SELECT a.key, a.name, a.description, a.metric, a.threshold, u.guild_id, u.user_id, u.game_id, u.unlocked_at
+        FROM user_achievements u JOIN achievements a ON a.key = u.achievement
+        WHERE u.guild_id = ? AND u.user_id = ? ORDER BY u.unlocked_at, a.key`, guildID, userID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var unlocked []UserAchievement
+    for rows.Next() {
+        var u UserAchievement
+        if err := rows.Scan(&u.Key, &u.Name, &u.Description, &u.Metric, &u.Threshold, &u.GuildID, &u.UserID, &u.GameID, &u.UnlockedAt); err != nil {
+            return nil, err
+        }
+        unlocked = append(unlocked, u)
+    }
+    return unlocked, rows.Err()
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+    "sort"
+    "strings"
+    "time"
+)
+
+// wrongAnswersShown is how many of the most common wrong answers
+// GetQuestionStats returns.
+const wrongAnswersShown = 5
+
+// RecordAttempt stores an answer to a question.
+func (db *DB) RecordAttempt(a *Attempt) error {
+    a.AttemptedAt = time.Now().UTC()
+    _, err := db.Exec(`INSERT INTO answer_attempts (game_id, guild_id, question_id, user_id, answer, correct, latency_ms, attempted_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+        a.GameID, a.GuildID, a.QuestionID, a.UserID, a.Answer, a.Correct, a.Latency.Milliseconds(), a.AttemptedAt)
+    return err
+}
+
+// GetQuestionStats summarizes the attempts at a question, with its most
+// common wrong answers. A question nobody has answered has zero attempts.
+func (db *DB) GetQuestionStats(questionID int) (*QuestionStats, error) {
+    rows, err := db.Query("SELECT answer, correct, latency_ms FROM answer_attempts WHERE question_id = ?", questionID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var attempts []Attempt
+    for rows.Next() {
+        var a Attempt
+        var latency int64
+        if err := rows.Scan(&a.Answer, &a.Correct, &latency); err != nil {
+            return nil, err
+        }
+        a.Latency = time.Duration(latency) * time.Millisecond
+        attempts = append(attempts, a)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+    return summarize(questionID, attempts), nil
+}
+
+// ListQuestionStats returns the attempt counts of every question that has
+// been answered, by question ID. Latencies and wrong answers are left out.
+func (db *DB) ListQuestionStats() ([]QuestionStats, error) {
+    rows, err := db.Query("SELECT question_id, COUNT(*), SUM(correct) FROM answer_attempts GROUP BY question_id ORDER BY question_id")
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var stats []QuestionStats
+    for rows.Next() {
+        var s QuestionStats
+        if err := rows.Scan(&s.QuestionID, &s.Attempts, &s.Correct); err != nil {
+            return nil, err
+        }
+        stats = append(stats, s)
+    }
+    return stats, rows.Err()
+}
+
+// ListGameAttempts returns every answer given in a game, oldest first.
+func (db *DB) ListGameAttempts(gameID int) ([]Attempt, error) {
+    rows, err := db.Query(`SELECT game_id, guild_id, question_id, user_id, answer, correct, latency_ms, attempted_at
+        FROM answer_attempts WHERE game_id = ? ORDER BY id`, gameID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var attempts []Attempt
+    for rows.Next() {
+        var a Attempt
+        var latency int64
+        if err := rows.Scan(&a.GameID, &a.GuildID, &a.QuestionID, &a.UserID, &a.Answer, &a.Correct, &latency, &a.AttemptedAt); err != nil {
+            return nil, err
+        }
+        a.Latency = time.Duration(latency) * time.Millisecond
+        attempts = append(attempts, a)
+    }
+    return attempts, rows.Err()
+}
+
+// summarize works out a question's statistics from its attempts. Both
+// stores use it so they agree on medians and on grouping wrong answers.
+func summarize(questionID int, attempts []Attempt) *QuestionStats {
+    s := &QuestionStats{QuestionID: questionID, Attempts: len(attempts)}
+    var latencies []time.Duration
+    wrong := make(map[string]int)
+    for _, a := range attempts {
+        latencies = append(latencies, a.Latency)
+        if a.Correct {
+            s.Correct++
+            continue
+        }
+        wrong[strings.ToLower(strings.TrimSpace(a.Answer))]++
+    }
+
+    if n := len(latencies); n > 0 {
+        sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+        s.MedianLatency = latencies[n/2]
+        if n%2 == 0 {
+            s.MedianLatency = (latencies[n/2-1] + latencies[n/2]) / 2
+        }
+    }
+
+    for answer, count := range wrong {
+        s.WrongAnswers = append(s.WrongAnswers, AnswerCount{Answer: answer, Count: count})
+    }
+    sort.Slice(s.WrongAnswers, func(i, j int) bool {
+        a, b := s.WrongAnswers[i], s.WrongAnswers[j]
+        if a.Count != b.Count {
+            return a.Count > b.Count
+        }
+        return a.Answer < b.Answer
+    })
+    if len(s.WrongAnswers) > wrongAnswersShown {
+        s.WrongAnswers = s.WrongAnswers[:wrongAnswersShown]
+    }
+    return s
+}
@@ -2,57 +2,167 @@ package db
 
 import (
     "database/sql"
+    "encoding/json"
+    "fmt"
     "log"
-    "os"
     "strings"
+    "time"
 
     _ "github.com/mattn/go-sqlite3"
 )
 
 type DB struct {
     *sql.DB
+
+    // DefaultGuildID receives players and teams from before scores were kept
+    // per guild when the migration to per-guild scores runs.
+    DefaultGuildID string
 }
 
-func NewDB() (*DB, error) {
-    dbPath := os.Getenv("DATABASE_PATH")
-    if dbPath == "" {
-        dbPath = "./trivia.db" // Fallback for local development
-    }
-    log.Printf("Opening database at: %s", dbPath)
-    db, err := sql.Open("sqlite3", dbPath)
+// Open opens the database at path without touching its schema.
+func Open(path string) (*DB, error) {
+    log.Printf("Opening database at: %s", path)
+    db, err := sql.Open("sqlite3", path)
     if err != nil {
         return nil, err
     }
+    return &DB{DB: db}, nil
+}
 
-    // Initialize tables
-    _, err = db.Exec(`
-        CREATE TABLE IF NOT EXISTS questions (
-            id INTEGER PRIMARY KEY AUTOINCREMENT,
-            text TEXT,
-            answer TEXT
-        );
-        CREATE TABLE IF NOT EXISTS players (
-            user_id TEXT PRIMARY KEY,
-            team TEXT,
-            score INTEGER
-        );
-        CREATE TABLE IF NOT EXISTS teams (
-            name TEXT PRIMARY KEY,
-            score INTEGER
-        );
-    `)
+// NewDB opens the database and brings its schema up to date.
+func NewDB(path, defaultGuildID string) (*DB, error) {
+    db, err := Open(path)
     if err != nil {
         return nil, err
     }
+    db.DefaultGuildID = defaultGuildID
+    if _, err := db.Migrate(); err != nil {
+        db.Close()
+        return nil, err
+    }
+    return db, nil
+}
 
-    return &DB{db}, nil
+// questionColumns is the column list read by scanQuestion.
+const questionColumns = "id, text, answer, kind, choices, aliases, exact, category, tags, difficulty"
+
+type rowScanner interface {
+    Scan(dest ...interface{}) error
 }
 
-func (db *DB) AddQuestion(text, answer string) error {
-    text = strings.TrimSpace(text)
-    answer = strings.TrimSpace(answer)
-    _, err := db.Exec("INSERT INTO questions (text, answer) VALUES (?, ?)", text, answer)
-    return err
+func scanQuestion(row rowScanner) (*Question, error) {
+    var q Question
+    var choices, aliases, tags string
+    if err := row.Scan(&q.ID, &q.Text, &q.Answer, &q.Kind, &choices, &aliases, &q.ExactOnly, &q.Category, &tags, &q.Difficulty); err != nil {
+        return nil, err
+    }
+    if err := decodeList(choices, &q.Distractors); err != nil {
+        return nil, fmt.Errorf("question %d has invalid choices: %w", q.ID, err)
+    }
+    if err := decodeList(aliases, &q.Aliases); err != nil {
+        return nil, fmt.Errorf("question %d has invalid aliases: %w", q.ID, err)
+    }
+    if err := decodeList(tags, &q.Tags); err != nil {
+        return nil, fmt.Errorf("question %d has invalid tags: %w", q.ID, err)
+    }
+    return &q, nil
+}
+
+// encodeList stores a string list as a JSON array, or "" when empty.
+func encodeList(list []string) (string, error) {
+    if len(list) == 0 {
+        return "", nil
+    }
+    encoded, err := json.Marshal(list)
+    return string(encoded), err
+}
+
+func decodeList(encoded string, list *[]string) error {
+    if encoded == "" {
+        return nil
+    }
+    return json.Unmarshal([]byte(encoded), list)
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+    Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// saveQuestion inserts q, or replaces the stored question when q.ID is set
+// and already exists. New questions get their ID filled in.
+func saveQuestion(e execer, q *Question) error {
+    q.normalize()
+
+    choices, err := encodeList(q.Distractors)
+    if err != nil {
+        return err
+    }
+    aliases, err := encodeList(q.Aliases)
+    if err != nil {
+        return err
+    }
+    tags, err := encodeList(q.Tags)
+    if err != nil {
+        return err
+    }
+
+    var id interface{} // NULL lets SQLite pick the next ID
+    if q.ID != 0 {
+        id = q.ID
+    }
+    res, err := e.Exec(`INSERT INTO questions (id, text, answer, kind, choices, aliases, exact, category, tags, difficulty)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+        ON CONFLICT (id) DO UPDATE SET
+            text = excluded.text, answer = excluded.answer, kind = excluded.kind, choices = excluded.choices,
+            aliases = excluded.aliases, exact = excluded.exact, category = excluded.category,
+            tags = excluded.tags, difficulty = excluded.difficulty`,
+        id, q.Text, q.Answer, q.Kind, choices, aliases, q.ExactOnly, q.Category, tags, q.Difficulty)
+    if err != nil {
+        return err
+    }
+    if q.ID == 0 {
+        newID, err := res.LastInsertId()
+        if err != nil {
+            return err
+        }
+        q.ID = int(newID)
+    }
+    return nil
+}
+
+func (db *DB) AddQuestion(q *Question) error {
+    q.ID = 0
+    return saveQuestion(db, q)
+}
+
+// UpdateQuestion replaces every field of an existing question.
+func (db *DB) UpdateQuestion(q *Question) error {
+    if _, err := db.GetQuestion(q.ID); err != nil {
+        return err
+    }
+    return saveQuestion(db, q)
+}
+
+func (db *DB) GetQuestion(id int) (*Question, error) {
+    return scanQuestion(db.QueryRow("SELECT "+questionColumns+" FROM questions WHERE id = ?", id))
+}
+
+// ImportQuestions saves all questions in one transaction, so either every
+// row is imported or none is. Questions with an ID replace the stored
+// question with that ID, or are created with it.
+func (db *DB) ImportQuestions(questions []*Question) error {
+    tx, err := db.Begin()
+    if err != nil {
+        return err
+    }
+    for _, q := range questions {
+        if err := saveQuestion(tx, q); err != nil {
+            tx.Rollback()
+            return fmt.Errorf("question %q: %w", q.Text, err)
+        }
+    }
+    return tx.Commit()
 }
 
 func (db *DB) RemoveQuestion(id int) error {
@@ -60,33 +170,113 @@ func (db *DB) RemoveQuestion(id int) error {
     return err
 }
 
-func (db *DB) GetRandomQuestion() (*Question, error) {
-    var q Question
-    err := db.QueryRow("SELECT id, text, answer FROM questions ORDER BY RANDOM() LIMIT 1").Scan(&q.ID, &q.Text, &q.Answer)
-    return &q, err
+// filterClause turns a filter into a WHERE clause and its arguments.
+func filterClause(f QuestionFilter) (string, []interface{}) {
+    var conditions []string
+    var args []interface{}
+    if f.Category != "" {
+        conditions = append(conditions, "category = ? COLLATE NOCASE")
+        args = append(args, f.Category)
+    }
+    if f.Tag != "" {
+        conditions = append(conditions, "EXISTS (SELECT 1 FROM json_each(CASE WHEN tags = '' THEN '[]' ELSE tags END) WHERE value = ? COLLATE NOCASE)")
+        args = append(args, f.Tag)
+    }
+    if f.Difficulty != 0 {
+        conditions = append(conditions, "difficulty = ?")
+        args = append(args, f.Difficulty)
+    }
+    if len(conditions) == 0 {
+        return "", nil
+    }
+    return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// GetRandomQuestion picks a question matching the filter that the exclusion
+// doesn't rule out.
+func (db *DB) GetRandomQuestion(filter QuestionFilter, exclude Exclusion) (*Question, error) {
+    where, args := filterClause(filter)
+    if exclude.GameID != 0 || exclude.Games > 0 || !exclude.Since.IsZero() {
+        if where == "" {
+            where = " WHERE "
+        } else {
+            where += " AND "
+        }
+        where += `id NOT IN (SELECT question_id FROM game_questions WHERE game_id = ?
+            OR game_id IN (SELECT id FROM games WHERE guild_id = ? AND id < ? ORDER BY id DESC LIMIT ?)
+            OR (guild_id = ? AND asked_at > ?))`
+        since := exclude.Since
+        if since.IsZero() {
+            since = time.Now().UTC() // Matches nothing
+        }
+        args = append(args, exclude.GameID, exclude.GuildID, exclude.GameID, exclude.Games, exclude.GuildID, since.UTC())
+    }
+    return scanQuestion(db.QueryRow("SELECT "+questionColumns+" FROM questions"+where+" ORDER BY RANDOM() LIMIT 1", args...))
 }
 
-func (db *DB) JoinTeam(userID, team string) error {
+// ListCategories returns every category with its number of questions.
+func (db *DB) ListCategories() ([]CategoryCount, error) {
+    rows, err := db.Query("SELECT category, COUNT(*) FROM questions GROUP BY category COLLATE NOCASE ORDER BY category COLLATE NOCASE")
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var categories []CategoryCount
+    for rows.Next() {
+        var c CategoryCount
+        if err := rows.Scan(&c.Category, &c.Count); err != nil {
+            return nil, err
+        }
+        categories = append(categories, c)
+    }
+    return categories, rows.Err()
+}
+
+func (db *DB) JoinTeam(guildID, userID, team string) error {
     team = strings.ToLower(strings.TrimSpace(team))
-    _, err := db.Exec("INSERT OR REPLACE INTO players (user_id, team, score) VALUES (?, ?, 0)", userID, team)
+    _, err := db.Exec("INSERT OR REPLACE INTO players (guild_id, user_id, team, score) VALUES (?, ?, ?, 0)", guildID, userID, team)
     if err != nil {
         return err
     }
-    _, err = db.Exec("INSERT OR IGNORE INTO teams (name, score) VALUES (?, 0)", team)
+    _, err = db.Exec("INSERT OR IGNORE INTO teams (guild_id, name, score) VALUES (?, ?, 0)", guildID, team)
     return err
 }
 
-func (db *DB) AddScore(userID, team string, points int) error {
-    _, err := db.Exec("UPDATE players SET score = score + ? WHERE user_id = ?", points, userID)
+// GetPlayerTeam returns the team the player joined in the guild.
+func (db *DB) GetPlayerTeam(guildID, userID string) (string, error) {
+    var team string
+    err := db.QueryRow("SELECT team FROM players WHERE guild_id = ? AND user_id = ?", guildID, userID).Scan(&team)
+    return strings.TrimSpace(team), err
+}
+
+// AddScore adds points to the player's and team's all-time totals and, when
+// gameID is set, to the game's scoreboard.
+func (db *DB) AddScore(guildID string, gameID int, userID, team string, points int) error {
+    tx, err := db.Begin()
     if err != nil {
         return err
     }
-    _, err = db.Exec("UPDATE teams SET score = score + ? WHERE name = ?", points, team)
-    return err
+    defer tx.Rollback()
+
+    if _, err := tx.Exec("UPDATE players SET score = score + ? WHERE guild_id = ? AND user_id = ?", points, guildID, userID); err != nil {
+        return err
+    }
+    if _, err := tx.Exec("UPDATE teams SET score = score + ? WHERE guild_id = ? AND name = ?", points, guildID, team); err != nil {
+        return err
+    }
+    if gameID != 0 {
+        if _, err := tx.Exec(`INSERT INTO game_scores (game_id, user_id, team, score) VALUES (?, ?, ?, ?)
+            ON CONFLICT (game_id, user_id) DO UPDATE SET score = score + excluded.score, team = excluded.team`,
+            gameID, userID, team, points); err != nil {
+            return err
+        }
+    }
+    return tx.Commit()
 }
 
-func (db *DB) GetScores() ([]Player, []Team, error) {
-    players, err := db.Query("SELECT user_id, team, score FROM players ORDER BY score DESC")
+func (db *DB) GetScores(guildID string) ([]Player, []Team, error) {
+    players, err := db.Query("SELECT guild_id, user_id, team, score FROM players WHERE guild_id = ? ORDER BY score DESC", guildID)
     if err != nil {
         return nil, nil, err
     }
@@ -95,13 +285,13 @@ func (db *DB) GetScores() ([]Player, []Team, error) {
     var playerList []Player
     for players.Next() {
         var p Player
-        if err := players.Scan(&p.UserID, &p.Team, &p.Score); err != nil {
+        if err := players.Scan(&p.GuildID, &p.UserID, &p.Team, &p.Score); err != nil {
             return nil, nil, err
         }
         playerList = append(playerList, p)
     }
 
-    teams, err := db.Query("SELECT name, score FROM teams ORDER BY score DESC")
+    teams, err := db.Query("SELECT guild_id, name, score FROM teams WHERE guild_id = ? ORDER BY score DESC", guildID)
     if err != nil {
         return nil, nil, err
     }
@@ -110,7 +300,7 @@ func (db *DB) GetScores() ([]Player, []Team, error) {
     var teamList []Team
     for teams.Next() {
         var t Team
-        if err := teams.Scan(&t.Name, &t.Score); err != nil {
+        if err := teams.Scan(&t.GuildID, &t.Name, &t.Score); err != nil {
             return nil, nil, err
         }
         teamList = append(teamList, t)
@@ -119,17 +309,17 @@ func (db *DB) GetScores() ([]Player, []Team, error) {
     return playerList, teamList, nil
 }
 
-func (db *DB) ResetScoresAndTeams() error {
-    _, err := db.Exec("DELETE FROM teams")
+func (db *DB) ResetScoresAndTeams(guildID string) error {
+    _, err := db.Exec("DELETE FROM teams WHERE guild_id = ?", guildID)
     if err != nil {
         return err
     }
-    _, err = db.Exec("DELETE FROM players")
+    _, err = db.Exec("DELETE FROM players WHERE guild_id = ?", guildID)
     return err
 }
 
 func (db *DB) ListQuestions() ([]Question, error) {
-    rows, err := db.Query("SELECT id, text, answer FROM questions ORDER BY id")
+    rows, err := db.Query("SELECT " + questionColumns + " FROM questions ORDER BY id")
     if err != nil {
         return nil, err
     }
@@ -137,11 +327,11 @@ func (db *DB) ListQuestions() ([]Question, error) {
 
     var questions []Question
     for rows.Next() {
-        var q Question
-        if err := rows.Scan(&q.ID, &q.Text, &q.Answer); err != nil {
+        q, err := scanQuestion(rows)
+        if err != nil {
             return nil, err
         }
-        questions = append(questions, q)
+        questions = append(questions, *q)
     }
 
     return questions, nil
@@ -0,0 +1,148 @@
+package db
+
+import (
+    "database/sql"
+    "sort"
+    "time"
+)
+
+// StartGame records a new game session and returns its ID.
+func (db *DB) StartGame(guildID, channelID, startedBy, rules string) (int, error) {
+    res, err := db.Exec("INSERT INTO games (guild_id, channel_id, started_by, started_at, rules) VALUES (?, ?, ?, ?, ?)",
+        guildID, channelID, startedBy, time.Now().UTC(), rules)
+    if err != nil {
+        return 0, err
+    }
+    id, err := res.LastInsertId()
+    return int(id), err
+}
+
+// EndGame marks a game session as finished.
+func (db *DB) EndGame(gameID int, reason string, questions int) error {
+    _, err := db.Exec("UPDATE games SET ended_at = ?, end_reason = ?, questions = ? WHERE id = ? AND ended_at IS NULL",
+        time.Now().UTC(), reason, questions, gameID)
+    return err
+}
+
+// RecordAskedQuestion notes that a game asked a question, so it isn't asked
+// again while excluded.
+func (db *DB) RecordAskedQuestion(guildID string, gameID, questionID int) error {
+    _, err := db.Exec("INSERT OR IGNORE INTO game_questions (game_id, question_id, guild_id, asked_at) VALUES (?, ?, ?, ?)",
+        gameID, questionID, guildID, time.Now().UTC())
+    return err
+}
+
+// SaveGameState stores a running game's state, replacing any saved before.
+func (db *DB) SaveGameState(g *SavedGame) error {
+    g.SavedAt = time.Now().UTC()
+    _, err := db.Exec(`INSERT INTO game_state (game_id, guild_id, channel_id, state, saved_at) VALUES (?, ?, ?, ?, ?)
+        ON CONFLICT (game_id) DO UPDATE SET state = excluded.state, saved_at = excluded.saved_at`,
+        g.GameID, g.GuildID, g.ChannelID, g.State, g.SavedAt)
+    return err
+}
+
+// ListGameStates returns every saved game state, oldest game first.
+func (db *DB) ListGameStates() ([]SavedGame, error) {
+    rows, err := db.Query("SELECT game_id, guild_id, channel_id, state, saved_at FROM game_state ORDER BY game_id")
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var saved []SavedGame
+    for rows.Next() {
+        var g SavedGame
+        if err := rows.Scan(&g.GameID, &g.GuildID, &g.ChannelID, &g.State, &g.SavedAt); err != nil {
+            return nil, err
+        }
+        saved = append(saved, g)
+    }
+    return saved, rows.Err()
+}
+
+func (db *DB) DeleteGameState(gameID int) error {
+    _, err := db.Exec("DELETE FROM game_state WHERE game_id = ?", gameID)
+    return err
+}
+
+// gameColumns is the column list read by scanGame, including the winner.
+const gameColumns = `g.id, g.guild_id, g.channel_id, g.started_by, g.started_at, g.ended_at, g.end_reason, g.rules, g.questions,
+    (SELECT user_id FROM game_scores s WHERE s.game_id = g.id ORDER BY score DESC LIMIT 1),
+    (SELECT MAX(score) FROM game_scores s WHERE s.game_id = g.id)`
+
+func scanGame(row rowScanner) (*Game, error) {
+    var g Game
+    var endedAt sql.NullTime
+    var winnerID sql.NullString
+    var winnerScore sql.NullInt64
+    if err := row.Scan(&g.ID, &g.GuildID, &g.ChannelID, &g.StartedBy, &g.StartedAt, &endedAt, &g.EndReason, &g.Rules, &g.Questions, &winnerID, &winnerScore); err != nil {
+        return nil, err
+    }
+    g.EndedAt = endedAt.Time
+    g.WinnerID = winnerID.String
+    g.WinnerScore = int(winnerScore.Int64)
+    return &g, nil
+}
+
+func (db *DB) GetGame(gameID int) (*Game, error) {
+    return scanGame(db.QueryRow("SELECT "+gameColumns+" FROM games g WHERE g.id = ?", gameID))
+}
+
+// LatestGame returns the most recent game in the guild.
+func (db *DB) LatestGame(guildID string) (*Game, error) {
+    return scanGame(db.QueryRow("SELECT "+gameColumns+" FROM games g WHERE g.guild_id = ? ORDER BY g.id DESC LIMIT 1", guildID))
+}
+
+// ListGames returns the guild's most recent games, newest first.
+func (db *DB) ListGames(guildID string, limit int) ([]Game, error) {
+    rows, err := db.Query("SELECT "+gameColumns+" FROM games g WHERE g.guild_id = ? ORDER BY g.id DESC LIMIT ?", guildID, limit)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var games []Game
+    for rows.Next() {
+        g, err := scanGame(rows)
+        if err != nil {
+            return nil, err
+        }
+        games = append(games, *g)
+    }
+    return games, rows.Err()
+}
+
+// GetGameScores returns a game's scoreboard, players and teams sorted by score.
+func (db *DB) GetGameScores(gameID int) ([]Player, []Team, error) {
+    rows, err := db.Query(`SELECT g.guild_id, s.user_id, s.team, s.score FROM game_scores s
+        JOIN games g ON g.id = s.game_id WHERE s.game_id = ? ORDER BY s.score DESC`, gameID)
+    if err != nil {
+        return nil, nil, err
+    }
+    defer rows.Close()
+
+    var players []Player
+    teamScores := make(map[string]int)
+    var teamOrder []string
+    for rows.Next() {
+        var p Player
+        if err := rows.Scan(&p.GuildID, &p.UserID, &p.Team, &p.Score); err != nil {
+            return nil, nil, err
+        }
+        players = append(players, p)
+        if _, seen := teamScores[p.Team]; !seen {
+            teamOrder = append(teamOrder, p.Team)
+        }
+        teamScores[p.Team] += p.Score
+    }
+    if err := rows.Err(); err != nil {
+        return nil, nil, err
+    }
+
+    var teams []Team
+    for _, name := range teamOrder {
+        teams = append(teams, Team{GuildID: players[0].GuildID, Name: name, Score: teamScores[name]})
+    }
+    sort.SliceStable(teams, func(i, j int) bool { return teams[i].Score > teams[j].Score })
+    return players, teams, nil
+}
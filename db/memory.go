@@ -0,0 +1,691 @@
+package db
+
+import (
+    "database/sql"
+    "fmt"
+    "math/rand"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Memory is a Store that keeps everything in process and loses it on exit.
+// It behaves like DB, including returning sql.ErrNoRows for missing rows.
+type Memory struct {
+    mutex          sync.Mutex
+    questions      map[int]*Question
+    lastQuestionID int // Like AUTOINCREMENT, IDs are never reused
+    players        []*Player
+    teams          []*Team
+    games          []*Game // games[i] has ID i+1
+    gameScores     map[int][]*Player
+    settings       map[string]map[string]string // Guild to key to value
+    gameStates     map[int]SavedGame
+    asked          []askedQuestion
+    attempts       []Attempt
+    achievements   []Achievement
+    unlocked       []UserAchievement
+    tokens         []*APIToken
+    lastTokenID    int
+}
+
+func NewMemory() *Memory {
+    return &Memory{
+        questions:    make(map[int]*Question),
+        gameScores:   make(map[int][]*Player),
+        settings:     make(map[string]map[string]string),
+        gameStates:   make(map[int]SavedGame),
+        achievements: append([]Achievement(nil), DefaultAchievements...),
+    }
+}
+
+// askedQuestion is a row of game_questions.
+type askedQuestion struct {
+    gameID, questionID int
+    guildID            string
+    at                 time.Time
+}
+
+// copyQuestion returns a copy that shares no slices with q.
+func copyQuestion(q *Question) *Question {
+    c := *q
+    c.Distractors = append([]string(nil), q.Distractors...)
+    c.Aliases = append([]string(nil), q.Aliases...)
+    c.Tags = append([]string(nil), q.Tags...)
+    return &c
+}
+
+// save stores a copy of q. The caller holds the lock.
+func (m *Memory) save(q *Question) {
+    q.normalize()
+    if q.ID == 0 {
+        q.ID = m.lastQuestionID + 1
+    }
+    if q.ID > m.lastQuestionID {
+        m.lastQuestionID = q.ID
+    }
+    m.questions[q.ID] = copyQuestion(q)
+}
+
+func (m *Memory) AddQuestion(q *Question) error {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    q.ID = 0
+    m.save(q)
+    return nil
+}
+
+func (m *Memory) UpdateQuestion(q *Question) error {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    if _, ok := m.questions[q.ID]; !ok {
+        return sql.ErrNoRows
+    }
+    m.save(q)
+    return nil
+}
+
+func (m *Memory) GetQuestion(id int) (*Question, error) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    q, ok := m.questions[id]
+    if !ok {
+        return nil, sql.ErrNoRows
+    }
+    return copyQuestion(q), nil
+}
+
+func (m *Memory) ImportQuestions(questions []*Question) error {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    for _, q := range questions {
+        m.save(q)
+    }
+    return nil
+}
+
+func (m *Memory) RemoveQuestion(id int) error {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    delete(m.questions, id)
+    return nil
+}
+
+// Matches reports whether q passes the filter, ignoring case like the SQL
+// filter does.
+func (f QuestionFilter) Matches(q *Question) bool {
+    if f.Category != "" && !strings.EqualFold(q.Category, f.Category) {
+        return false
+    }
+    if f.Difficulty != 0 && q.Difficulty != f.Difficulty {
+        return false
+    }
+    if f.Tag == "" {
+        return true
+    }
+    for _, tag := range q.Tags {
+        if strings.EqualFold(tag, f.Tag) {
+            return true
+        }
+    }
+    return false
+}
+
+func (m *Memory) GetRandomQuestion(filter QuestionFilter, exclude Exclusion) (*Question, error) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+
+    // The guild's last exclude.Games games before this one
+    recent := make(map[int]bool)
+    for i := len(m.games) - 1; i >= 0 && len(recent) < exclude.Games; i-- {
+        if g := m.games[i]; g.GuildID == exclude.GuildID && g.ID < exclude.GameID {
+            recent[g.ID] = true
+        }
+    }
+    excluded := make(map[int]bool)
+    for _, a := range m.asked {
+        if a.gameID == exclude.GameID || recent[a.gameID] || (!exclude.Since.IsZero() && a.guildID == exclude.GuildID && a.at.After(exclude.Since)) {
+            excluded[a.questionID] = true
+        }
+    }
+
+    var candidates []*Question
+    for _, q := range m.questions {
+        if filter.Matches(q) && !excluded[q.ID] {
+            candidates = append(candidates, q)
+        }
+    }
+    if len(candidates) == 0 {
+        return nil, sql.ErrNoRows
+    }
+    return copyQuestion(candidates[rand.Intn(len(candidates))]), nil
+}
+
+func (m *Memory) ListQuestions() ([]Question, error) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    var questions []Question
+    for _, q := range m.questions {
+        questions = append(questions, *copyQuestion(q))
+    }
+    sort.Slice(questions, func(i, j int) bool { return questions[i].ID < questions[j].ID })
+    return questions, nil
+}
+
+func (m *Memory) ListCategories() ([]CategoryCount, error) {
+    questions, _ := m.ListQuestions()
+    var categories []CategoryCount
+    index := make(map[string]int) // Lowercased category to its position
+    for _, q := range questions {
+        key := strings.ToLower(q.Category)
+        if i, ok := index[key]; ok {
+            categories[i].Count++
+            continue
+        }
+        index[key] = len(categories)
+        categories = append(categories, CategoryCount{Category: q.Category, Count: 1})
+    }
+    sort.Slice(categories, func(i, j int) bool {
+        return strings.ToLower(categories[i].Category) < strings.ToLower(categories[j].Category)
+    })
+    return categories, nil
+}
+
+// player finds a player. The caller holds the lock.
+func (m *Memory) player(guildID, userID string) *Player {
+    for _, p := range m.players {
+        if p.GuildID == guildID && p.UserID == userID {
+            return p
+        }
+    }
+    return nil
+}
+
+// team finds a team. The caller holds the lock.
+func (m *Memory) team(guildID, name string) *Team {
+    for _, t := range m.teams {
+        if t.GuildID == guildID && t.Name == name {
+            return t
+        }
+    }
+    return nil
+}
+
+// JoinTeam puts the player on the team with a fresh score, as DB does.
+func (m *Memory) JoinTeam(guildID, userID, team string) error {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    team = strings.ToLower(strings.TrimSpace(team))
+    if p := m.player(guildID, userID); p != nil {
+        p.Team = team
+        p.Score = 0
+    } else {
+        m.players = append(m.players, &Player{GuildID: guildID, UserID: userID, Team: team})
+    }
+    if m.team(guildID, team) == nil {
+        m.teams = append(m.teams, &Team{GuildID: guildID, Name: team})
+    }
+    return nil
+}
+
+func (m *Memory) GetPlayerTeam(guildID, userID string) (string, error) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    p := m.player(guildID, userID)
+    if p == nil {
+        return "", sql.ErrNoRows
+    }
+    return p.Team, nil
+}
+
+func (m *Memory) AddScore(guildID string, gameID int, userID, team string, points int) error {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    if p := m.player(guildID, userID); p != nil {
+        p.Score += points
+    }
+    if t := m.team(guildID, team); t != nil {
+        t.Score += points
+    }
+    if gameID == 0 {
+        return nil
+    }
+    for _, p := range m.gameScores[gameID] {
+        if p.UserID == userID {
+            p.Score += points
+            p.Team = team
+            return nil
+        }
+    }
+    m.gameScores[gameID] = append(m.gameScores[gameID], &Player{GuildID: guildID, UserID: userID, Team: team, Score: points})
+    return nil
+}
+
+func (m *Memory) GetScores(guildID string) ([]Player, []Team, error) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    var players []Player
+    for _, p := range m.players {
+        if p.GuildID == guildID {
+            players = append(players, *p)
+        }
+    }
+    var teams []Team
+    for _, t := range m.teams {
+        if t.GuildID == guildID {
+            teams = append(teams, *t)
+        }
+    }
+    sort.SliceStable(players, func(i, j int) bool { return players[i].Score > players[j].Score })
+    sort.SliceStable(teams, func(i, j int) bool { return teams[i].Score > teams[j].Score })
+    return players, teams, nil
+}
+
+func (m *Memory) GetProfile(guildID, userID string) (*Profile, error) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    p := &Profile{GuildID: guildID, UserID: userID}
+    if player := m.player(guildID, userID); player != nil {
+        p.Team = player.Team
+    }
+
+    played := make(map[int]bool)
+    var attempts []profileAttempt
+    for _, a := range m.attempts {
+        if a.GuildID != guildID || a.UserID != userID {
+            continue
+        }
+        played[a.GameID] = true
+        attempt := profileAttempt{correct: a.Correct, latency: a.Latency}
+        if q, ok := m.questions[a.QuestionID]; ok {
+            attempt.category = q.Category
+        }
+        attempts = append(attempts, attempt)
+    }
+    for _, g := range m.games {
+        if g.GuildID != guildID {
+            continue
+        }
+        score, best := 0, 0
+        for _, s := range m.gameScores[g.ID] {
+            if s.UserID == userID {
+                score = s.Score
+                p.Points += s.Score
+                played[g.ID] = true
+            }
+            if s.Score > best {
+                best = s.Score
+            }
+        }
+        if !g.EndedAt.IsZero() && score > 0 && score == best {
+            p.Wins++
+        }
+    }
+    p.Games = len(played)
+    p.addAttempts(attempts)
+    return p, nil
+}
+
+func (m *Memory) ResetScoresAndTeams(guildID string) error {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    var players []*Player
+    for _, p := range m.players {
+        if p.GuildID != guildID {
+            players = append(players, p)
+        }
+    }
+    var teams []*Team
+    for _, t := range m.teams {
+        if t.GuildID != guildID {
+            teams = append(teams, t)
+        }
+    }
+    m.players, m.teams = players, teams
+    return nil
+}
+
+func (m *Memory) StartGame(guildID, channelID, startedBy, rules string) (int, error) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    g := &Game{
+        ID:        len(m.games) + 1,
+        GuildID:   guildID,
+        ChannelID: channelID,
+        StartedBy: startedBy,
+        StartedAt: time.Now().UTC(),
+        Rules:     rules,
+    }
+    m.games = append(m.games, g)
+    return g.ID, nil
+}
+
+func (m *Memory) RecordAskedQuestion(guildID string, gameID, questionID int) error {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    for _, a := range m.asked {
+        if a.gameID == gameID && a.questionID == questionID {
+            return nil
+        }
+    }
+    m.asked = append(m.asked, askedQuestion{gameID: gameID, questionID: questionID, guildID: guildID, at: time.Now().UTC()})
+    return nil
+}
+
+func (m *Memory) EndGame(gameID int, reason string, questions int) error {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    if gameID < 1 || gameID > len(m.games) {
+        return nil
+    }
+    g := m.games[gameID-1]
+    if g.EndedAt.IsZero() {
+        g.EndedAt = time.Now().UTC()
+        g.EndReason = reason
+        g.Questions = questions
+    }
+    return nil
+}
+
+// game returns a copy of the game with its winner filled in. The caller
+// holds the lock.
+func (m *Memory) game(g *Game) *Game {
+    c := *g
+    for _, p := range m.gameScores[g.ID] {
+        if c.WinnerID == "" || p.Score > c.WinnerScore {
+            c.WinnerID = p.UserID
+            c.WinnerScore = p.Score
+        }
+    }
+    return &c
+}
+
+func (m *Memory) GetGame(gameID int) (*Game, error) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    if gameID < 1 || gameID > len(m.games) {
+        return nil, sql.ErrNoRows
+    }
+    return m.game(m.games[gameID-1]), nil
+}
+
+func (m *Memory) LatestGame(guildID string) (*Game, error) {
+    games, _ := m.ListGames(guildID, 1)
+    if len(games) == 0 {
+        return nil, sql.ErrNoRows
+    }
+    return &games[0], nil
+}
+
+func (m *Memory) ListGames(guildID string, limit int) ([]Game, error) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    var games []Game
+    for i := len(m.games) - 1; i >= 0 && len(games) < limit; i-- {
+        if m.games[i].GuildID == guildID {
+            games = append(games, *m.game(m.games[i]))
+        }
+    }
+    return games, nil
+}
+
+func (m *Memory) GetGameScores(gameID int) ([]Player, []Team, error) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    var players []Player
+    for _, p := range m.gameScores[gameID] {
+        players = append(players, *p)
+    }
+    sort.SliceStable(players, func(i, j int) bool { return players[i].Score > players[j].Score })
+
+    var teams []Team
+    index := make(map[string]int)
+    for _, p := range players {
+        if i, ok := index[p.Team]; ok {
+            teams[i].Score += p.Score
+            continue
+        }
+        index[p.Team] = len(teams)
+        teams = append(teams, Team{GuildID: p.GuildID, Name: p.Team, Score: p.Score})
+    }
+    sort.SliceStable(teams, func(i, j int) bool { return teams[i].Score > teams[j].Score })
+    return players, teams, nil
+}
+
+func (m *Memory) SaveGameState(g *SavedGame) error {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    g.SavedAt = time.Now().UTC()
+    m.gameStates[g.GameID] = *g
+    return nil
+}
+
+func (m *Memory) ListGameStates() ([]SavedGame, error) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    var saved []SavedGame
+    for _, g := range m.gameStates {
+        saved = append(saved, g)
+    }
+    sort.Slice(saved, func(i, j int) bool { return saved[i].GameID < saved[j].GameID })
+    return saved, nil
+}
+
+func (m *Memory) DeleteGameState(gameID int) error {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    delete(m.gameStates, gameID)
+    return nil
+}
+
+func (m *Memory) RecordAttempt(a *Attempt) error {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    a.AttemptedAt = time.Now().UTC()
+    m.attempts = append(m.attempts, *a)
+    return nil
+}
+
+func (m *Memory) GetQuestionStats(questionID int) (*QuestionStats, error) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    var attempts []Attempt
+    for _, a := range m.attempts {
+        if a.QuestionID == questionID {
+            attempts = append(attempts, a)
+        }
+    }
+    return summarize(questionID, attempts), nil
+}
+
+func (m *Memory) ListQuestionStats() ([]QuestionStats, error) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    byQuestion := make(map[int]*QuestionStats)
+    for _, a := range m.attempts {
+        s, ok := byQuestion[a.QuestionID]
+        if !ok {
+            s = &QuestionStats{QuestionID: a.QuestionID}
+            byQuestion[a.QuestionID] = s
+        }
+        s.Attempts++
+        if a.Correct {
+            s.Correct++
+        }
+    }
+
+    stats := make([]QuestionStats, 0, len(byQuestion))
+    for _, s := range byQuestion {
+        stats = append(stats, *s)
+    }
+    sort.Slice(stats, func(i, j int) bool { return stats[i].QuestionID < stats[j].QuestionID })
+    return stats, nil
+}
+
+func (m *Memory) ListGameAttempts(gameID int) ([]Attempt, error) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    var attempts []Attempt
+    for _, a := range m.attempts {
+        if a.GameID == gameID {
+            attempts = append(attempts, a)
+        }
+    }
+    return attempts, nil
+}
+
+func (m *Memory) ListAchievements() ([]Achievement, error) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    achievements := append([]Achievement(nil), m.achievements...)
+    sort.Slice(achievements, func(i, j int) bool { return achievements[i].Key < achievements[j].Key })
+    return achievements, nil
+}
+
+func (m *Memory) AddAchievement(a *Achievement) error {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    for _, existing := range m.achievements {
+        if existing.Key == a.Key {
+            return fmt.Errorf("achievement %q already exists", a.Key)
+        }
+    }
+    m.achievements = append(m.achievements, *a)
+    return nil
+}
+
+func (m *Memory) RemoveAchievement(key string) error {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    found := false
+    var achievements []Achievement
+    for _, a := range m.achievements {
+        if a.Key == key {
+            found = true
+            continue
+        }
+        achievements = append(achievements, a)
+    }
+    if !found {
+        return sql.ErrNoRows
+    }
+    m.achievements = achievements
+
+    var unlocked []UserAchievement
+    for _, u := range m.unlocked {
+        if u.Key != key {
+            unlocked = append(unlocked, u)
+        }
+    }
+    m.unlocked = unlocked
+    return nil
+}
+
+func (m *Memory) UnlockAchievement(guildID, userID, key string, gameID int) (bool, error) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    for _, u := range m.unlocked {
+        if u.GuildID == guildID && u.UserID == userID && u.Key == key {
+            return false, nil
+        }
+    }
+    for _, a := range m.achievements {
+        if a.Key == key {
+            m.unlocked = append(m.unlocked, UserAchievement{Achievement: a, GuildID: guildID, UserID: userID, GameID: gameID, UnlockedAt: time.Now().UTC()})
+            return true, nil
+        }
+    }
+    return false, fmt.Errorf("no achievement %q", key)
+}
+
+func (m *Memory) ListUserAchievements(guildID, userID string) ([]UserAchievement, error) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    var unlocked []UserAchievement
+    for _, u := range m.unlocked {
+        if u.GuildID == guildID && u.UserID == userID {
+            unlocked = append(unlocked, u)
+        }
+    }
+    return unlocked, nil
+}
+
+func (m *Memory) GetGuildSettings(guildID string) (map[string]string, error) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    settings := make(map[string]string)
+    for key, value := range m.settings[guildID] {
+        settings[key] = value
+    }
+    return settings, nil
+}
+
+func (m *Memory) SetGuildSetting(guildID, key, value string) error {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    if m.settings[guildID] == nil {
+        m.settings[guildID] = make(map[string]string)
+    }
+    m.settings[guildID][key] = value
+    return nil
+}
+
+func (m *Memory) ResetGuildSetting(guildID, key string) error {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    delete(m.settings[guildID], key)
+    return nil
+}
+
+func (m *Memory) CreateAPIToken(name, hash string) (int, error) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    for _, t := range m.tokens {
+        if t.Hash == hash {
+            return 0, fmt.Errorf("an API token with this hash already exists")
+        }
+    }
+    m.lastTokenID++
+    m.tokens = append(m.tokens, &APIToken{ID: m.lastTokenID, Name: name, Hash: hash, CreatedAt: time.Now().UTC()})
+    return m.lastTokenID, nil
+}
+
+func (m *Memory) UseAPIToken(hash string) (*APIToken, error) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    for _, t := range m.tokens {
+        if t.Hash == hash {
+            t.LastUsedAt = time.Now().UTC()
+            c := *t
+            return &c, nil
+        }
+    }
+    return nil, sql.ErrNoRows
+}
+
+func (m *Memory) ListAPITokens() ([]APIToken, error) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    var tokens []APIToken
+    for _, t := range m.tokens {
+        tokens = append(tokens, *t)
+    }
+    return tokens, nil
+}
+
+func (m *Memory) RevokeAPIToken(id int) error {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    for i, t := range m.tokens {
+        if t.ID == id {
+            m.tokens = append(m.tokens[:i], m.tokens[i+1:]...)
+            return nil
+        }
+    }
+    return sql.ErrNoRows
+}
+
+func (m *Memory) Close() error {
+    return nil
+}
@@ -0,0 +1,421 @@
+package db
+
+import (
+    "database/sql"
+    "fmt"
+    "log"
+    "strings"
+    "time"
+)
+
+// Migration is one numbered step of the schema. Migrations run in version
+// order, each in its own transaction together with the schema_migrations row
+// recording it. Databases created before versioning already have some of
+// these tables and columns, so every step must be safe to run on them.
+type Migration struct {
+    Version     int
+    Description string
+    up          func(db *DB, tx *sql.Tx) error
+}
+
+// migrations must stay sorted by version. Never edit or renumber a released
+// migration; append a new one instead.
+var migrations = []Migration{
+    {1, "create questions, players and teams", (*DB).migrateInitial},
+    {2, "scope players and teams per guild", (*DB).migrateGuildScope},
+    {3, "multiple-choice questions", addColumns("questions", []column{
+        {"kind", "TEXT NOT NULL DEFAULT 'text'"},
+        {"choices", "TEXT NOT NULL DEFAULT ''"}, // JSON array of wrong answers for multiple choice
+    })},
+    {4, "answer aliases and exact matching", addColumns("questions", []column{
+        {"aliases", "TEXT NOT NULL DEFAULT ''"}, // JSON array of other accepted answers
+        {"exact", "INTEGER NOT NULL DEFAULT 0"}, // 1 disables fuzzy answer matching
+    })},
+    {5, "question categories, tags and difficulty", addColumns("questions", []column{
+        {"category", "TEXT NOT NULL DEFAULT ''"},
+        {"tags", "TEXT NOT NULL DEFAULT ''"}, // JSON array
+        {"difficulty", "INTEGER NOT NULL DEFAULT 2"},
+    })},
+    {6, "game sessions and per-game scores", (*DB).migrateGames},
+    {7, "per-guild settings", (*DB).migrateGuildSettings},
+    {8, "HTTP API tokens", (*DB).migrateAPITokens},
+    {9, "saved state of running games", (*DB).migrateGameState},
+    {10, "questions asked in each game", (*DB).migrateGameQuestions},
+    {11, "answer attempts", (*DB).migrateAnswerAttempts},
+    {12, "achievements", (*DB).migrateAchievements},
+}
+
+// LatestVersion is the schema version this build migrates to.
+func LatestVersion() int {
+    return migrations[len(migrations)-1].Version
+}
+
+// AppliedMigration is a row of schema_migrations.
+type AppliedMigration struct {
+    Version     int
+    Description string
+    AppliedAt   time.Time
+}
+
+// SchemaVersion returns the highest applied migration, or 0 for a database
+// that has never been migrated.
+func (db *DB) SchemaVersion() (int, error) {
+    applied, err := db.AppliedMigrations()
+    if err != nil || len(applied) == 0 {
+        return 0, err
+    }
+    return applied[len(applied)-1].Version, nil
+}
+
+// AppliedMigrations lists the recorded migrations, oldest first. It does not
+// create schema_migrations, so it is safe to call on any database.
+func (db *DB) AppliedMigrations() ([]AppliedMigration, error) {
+    var name string
+    err := db.QueryRow("SELECT name FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'").Scan(&name)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    rows, err := db.Query("SELECT version, description, applied_at FROM schema_migrations ORDER BY version")
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var applied []AppliedMigration
+    for rows.Next() {
+        var m AppliedMigration
+        if err := rows.Scan(&m.Version, &m.Description, &m.AppliedAt); err != nil {
+            return nil, err
+        }
+        applied = append(applied, m)
+    }
+    return applied, rows.Err()
+}
+
+// PendingMigrations returns the migrations not yet applied, in the order
+// Migrate would run them.
+func (db *DB) PendingMigrations() ([]Migration, error) {
+    version, err := db.SchemaVersion()
+    if err != nil {
+        return nil, err
+    }
+    if version > LatestVersion() {
+        return nil, fmt.Errorf("database schema version %d is newer than this build supports (%d)", version, LatestVersion())
+    }
+
+    var pending []Migration
+    for _, m := range migrations {
+        if m.Version > version {
+            pending = append(pending, m)
+        }
+    }
+    return pending, nil
+}
+
+// Migrate applies every pending migration and returns the ones it ran. It
+// stops at the first failure, leaving the database at the last good version.
+func (db *DB) Migrate() ([]Migration, error) {
+    _, err := db.Exec(`
+        CREATE TABLE IF NOT EXISTS schema_migrations (
+            version INTEGER PRIMARY KEY,
+            description TEXT NOT NULL,
+            applied_at TIMESTAMP NOT NULL
+        );
+    `)
+    if err != nil {
+        return nil, err
+    }
+
+    pending, err := db.PendingMigrations()
+    if err != nil {
+        return nil, err
+    }
+
+    var applied []Migration
+    for _, m := range pending {
+        log.Printf("Applying migration %d: %s", m.Version, m.Description)
+        if err := db.apply(m); err != nil {
+            return applied, fmt.Errorf("migration %d (%s): %w", m.Version, m.Description, err)
+        }
+        applied = append(applied, m)
+    }
+    return applied, nil
+}
+
+func (db *DB) apply(m Migration) error {
+    tx, err := db.Begin()
+    if err != nil {
+        return err
+    }
+    if err := m.up(db, tx); err != nil {
+        tx.Rollback()
+        return err
+    }
+    if _, err := tx.Exec("INSERT INTO schema_migrations (version, description, applied_at) VALUES (?, ?, ?)",
+        m.Version, m.Description, time.Now().UTC()); err != nil {
+        tx.Rollback()
+        return err
+    }
+    return tx.Commit()
+}
+
+func (db *DB) migrateInitial(tx *sql.Tx) error {
+    _, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS questions (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            text TEXT,
+            answer TEXT
+        );
+        CREATE TABLE IF NOT EXISTS players (
+            user_id TEXT PRIMARY KEY,
+            team TEXT,
+            score INTEGER
+        );
+        CREATE TABLE IF NOT EXISTS teams (
+            name TEXT PRIMARY KEY,
+            score INTEGER
+        );
+    `)
+    return err
+}
+
+// migrateGuildScope rebuilds pre-guild players and teams tables with a guild_id
+// column. Existing rows are assigned to DefaultGuildID (or "default").
+func (db *DB) migrateGuildScope(tx *sql.Tx) error {
+    defaultGuild := db.DefaultGuildID
+    if defaultGuild == "" {
+        defaultGuild = "default"
+    }
+
+    rebuilds := []struct {
+        table string
+        stmts []string
+    }{
+        {"players", []string{
+            "ALTER TABLE players RENAME TO players_old",
+            `CREATE TABLE players (
+                guild_id TEXT NOT NULL,
+                user_id TEXT NOT NULL,
+                team TEXT,
+                score INTEGER,
+                PRIMARY KEY (guild_id, user_id)
+            )`,
+            "INSERT INTO players (guild_id, user_id, team, score) SELECT ?, user_id, team, score FROM players_old",
+            "DROP TABLE players_old",
+        }},
+        {"teams", []string{
+            "ALTER TABLE teams RENAME TO teams_old",
+            `CREATE TABLE teams (
+                guild_id TEXT NOT NULL,
+                name TEXT NOT NULL,
+                score INTEGER,
+                PRIMARY KEY (guild_id, name)
+            )`,
+            "INSERT INTO teams (guild_id, name, score) SELECT ?, name, score FROM teams_old",
+            "DROP TABLE teams_old",
+        }},
+    }
+
+    for _, r := range rebuilds {
+        _, scoped, err := hasColumn(tx, r.table, "guild_id")
+        if err != nil {
+            return err
+        }
+        if scoped {
+            continue
+        }
+
+        log.Printf("Migrating %s to per-guild scores (existing rows go to guild %q)", r.table, defaultGuild)
+        for _, stmt := range r.stmts {
+            var args []interface{}
+            if strings.Contains(stmt, "?") {
+                args = append(args, defaultGuild)
+            }
+            if _, err := tx.Exec(stmt, args...); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+func (db *DB) migrateGames(tx *sql.Tx) error {
+    _, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS games (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            guild_id TEXT NOT NULL,
+            channel_id TEXT NOT NULL,
+            started_by TEXT NOT NULL,
+            started_at TIMESTAMP NOT NULL,
+            ended_at TIMESTAMP,
+            end_reason TEXT NOT NULL DEFAULT '',
+            rules TEXT NOT NULL DEFAULT '',
+            questions INTEGER NOT NULL DEFAULT 0
+        );
+        CREATE INDEX IF NOT EXISTS games_guild ON games (guild_id, started_at);
+        CREATE TABLE IF NOT EXISTS game_scores (
+            game_id INTEGER NOT NULL REFERENCES games (id),
+            user_id TEXT NOT NULL,
+            team TEXT NOT NULL,
+            score INTEGER NOT NULL,
+            PRIMARY KEY (game_id, user_id)
+        );
+    `)
+    return err
+}
+
+func (db *DB) migrateGuildSettings(tx *sql.Tx) error {
+    _, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS guild_settings (
+            guild_id TEXT NOT NULL,
+            key TEXT NOT NULL,
+            value TEXT NOT NULL,
+            PRIMARY KEY (guild_id, key)
+        );
+    `)
+    return err
+}
+
+func (db *DB) migrateAPITokens(tx *sql.Tx) error {
+    _, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS api_tokens (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            name TEXT NOT NULL,
+            hash TEXT NOT NULL UNIQUE, -- SHA-256 of the token, which is never stored
+            created_at TIMESTAMP NOT NULL,
+            last_used_at TIMESTAMP
+        );
+    `)
+    return err
+}
+
+func (db *DB) migrateGameState(tx *sql.Tx) error {
+    _, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS game_state (
+            game_id INTEGER PRIMARY KEY REFERENCES games (id),
+            guild_id TEXT NOT NULL,
+            channel_id TEXT NOT NULL,
+            state TEXT NOT NULL, -- JSON written by the bot package
+            saved_at TIMESTAMP NOT NULL
+        );
+    `)
+    return err
+}
+
+func (db *DB) migrateGameQuestions(tx *sql.Tx) error {
+    _, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS game_questions (
+            game_id INTEGER NOT NULL REFERENCES games (id),
+            question_id INTEGER NOT NULL, -- No foreign key, so history outlives removed questions
+            guild_id TEXT NOT NULL,
+            asked_at TIMESTAMP NOT NULL,
+            PRIMARY KEY (game_id, question_id)
+        );
+        CREATE INDEX IF NOT EXISTS game_questions_guild ON game_questions (guild_id, asked_at);
+    `)
+    return err
+}
+
+func (db *DB) migrateAnswerAttempts(tx *sql.Tx) error {
+    _, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS answer_attempts (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            game_id INTEGER NOT NULL REFERENCES games (id),
+            guild_id TEXT NOT NULL,
+            question_id INTEGER NOT NULL, -- No foreign key, like game_questions
+            user_id TEXT NOT NULL,
+            answer TEXT NOT NULL,
+            correct INTEGER NOT NULL,
+            latency_ms INTEGER NOT NULL, -- Time from the question being posted
+            attempted_at TIMESTAMP NOT NULL
+        );
+        CREATE INDEX IF NOT EXISTS answer_attempts_question ON answer_attempts (question_id);
+    `)
+    return err
+}
+
+func (db *DB) migrateAchievements(tx *sql.Tx) error {
+    _, err := tx.Exec(`
+        CREATE TABLE IF NOT EXISTS achievements (
+            key TEXT PRIMARY KEY,
+            name TEXT NOT NULL,
+            description TEXT NOT NULL,
+            metric TEXT NOT NULL,
+            threshold INTEGER NOT NULL
+        );
+        CREATE TABLE IF NOT EXISTS user_achievements (
+            guild_id TEXT NOT NULL,
+            user_id TEXT NOT NULL,
+            achievement TEXT NOT NULL REFERENCES achievements (key),
+            game_id INTEGER NOT NULL REFERENCES games (id),
+            unlocked_at TIMESTAMP NOT NULL,
+            PRIMARY KEY (guild_id, user_id, achievement)
+        );
+    `)
+    if err != nil {
+        return err
+    }
+    for _, a := range DefaultAchievements {
+        if _, err := tx.Exec("INSERT OR IGNORE INTO achievements (key, name, description, metric, threshold) VALUES (?, ?, ?, ?, ?)",
+            a.Key, a.Name, a.Description, a.Metric, a.Threshold); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+type column struct {
+    name, definition string
+}
+
+// addColumns returns a migration adding columns to table, skipping any that
+// the pre-versioning schema code already added.
+func addColumns(table string, columns []column) func(db *DB, tx *sql.Tx) error {
+    return func(db *DB, tx *sql.Tx) error {
+        for _, col := range columns {
+            _, found, err := hasColumn(tx, table, col.name)
+            if err != nil {
+                return err
+            }
+            if found {
+                continue
+            }
+            if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, col.name, col.definition)); err != nil {
+                return err
+            }
+        }
+        return nil
+    }
+}
+
+// hasColumn reports whether table exists and whether it has the named column.
+func hasColumn(tx *sql.Tx, table, column string) (exists bool, found bool, err error) {
+    rows, err := tx.Query("PRAGMA table_info(" + table + ")")
+    if err != nil {
+        return false, false, err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        exists = true
+        var (
+            cid       int
+            name      string
+            colType   string
+            notNull   int
+            dfltValue sql.NullString
+            pk        int
+        )
+        if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+            return false, false, err
+        }
+        if name == column {
+            found = true
+        }
+    }
+    return exists, found, rows.Err()
+}
@@ -1,18 +1,290 @@
 package db
 
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Question kinds
+const (
+    KindText   = "text"   // Answered by typing
+    KindChoice = "choice" // Multiple choice, answered with buttons
+)
+
+// MaxDistractors is how many wrong answers a multiple-choice question can
+// have, giving at most four options (A-D).
+const MaxDistractors = 3
+
+// Difficulty levels
+const (
+    DifficultyEasy   = 1
+    DifficultyMedium = 2
+    DifficultyHard   = 3
+)
+
+var difficultyNames = map[int]string{
+    DifficultyEasy:   "easy",
+    DifficultyMedium: "medium",
+    DifficultyHard:   "hard",
+}
+
+// ParseDifficulty accepts a difficulty name (easy, medium, hard) or level (1-3).
+func ParseDifficulty(s string) (int, error) {
+    s = strings.ToLower(strings.TrimSpace(s))
+    for level, name := range difficultyNames {
+        if s == name || s == strconv.Itoa(level) {
+            return level, nil
+        }
+    }
+    return 0, fmt.Errorf("unknown difficulty %q, expected easy, medium or hard", s)
+}
+
+// DifficultyName returns the name of a difficulty level.
+func DifficultyName(level int) string {
+    if name, ok := difficultyNames[level]; ok {
+        return name
+    }
+    return "unrated"
+}
+
 type Question struct {
-    ID       int
-    Text     string
-    Answer   string
+    ID          int
+    Text        string
+    Answer      string
+    Kind        string
+    Distractors []string // Wrong answers offered alongside Answer for multiple choice
+    Aliases     []string // Other answers accepted for typed questions
+    ExactOnly   bool     // Skip fuzzy matching and accept only case-insensitive equality
+    Category    string
+    Tags        []string
+    Difficulty  int // One of the Difficulty constants
+}
+
+// QuestionFilter limits which questions a game draws. Empty fields match everything.
+type QuestionFilter struct {
+    Category   string
+    Tag        string
+    Difficulty int
+}
+
+func (f QuestionFilter) IsEmpty() bool {
+    return f.Category == "" && f.Tag == "" && f.Difficulty == 0
+}
+
+// String describes the filter for game announcements, e.g. "category Old Testament, easy".
+func (f QuestionFilter) String() string {
+    var parts []string
+    if f.Category != "" {
+        parts = append(parts, "category "+f.Category)
+    }
+    if f.Tag != "" {
+        parts = append(parts, "tag "+f.Tag)
+    }
+    if f.Difficulty != 0 {
+        parts = append(parts, DifficultyName(f.Difficulty))
+    }
+    return strings.Join(parts, ", ")
+}
+
+// Exclusion keeps questions that were asked recently out of
+// GetRandomQuestion. The zero value excludes nothing.
+type Exclusion struct {
+    GuildID string
+    GameID  int       // Skip questions this game has asked
+    Games   int       // Also skip questions from the guild's last Games games before this one
+    Since   time.Time // Also skip questions the guild was asked after this, unless zero
+}
+
+// Game is one recorded game session, from `!!trivia start` to its end.
+type Game struct {
+    ID          int
+    GuildID     string
+    ChannelID   string
+    StartedBy   string
+    StartedAt   time.Time
+    EndedAt     time.Time // Zero while the game is running
+    EndReason   string
+    Rules       string
+    Questions   int
+    WinnerID    string // Top scorer, empty if nobody scored
+    WinnerScore int
+}
+
+// SavedGame is the saved state of a running game, kept up to date so the
+// game can resume after a restart. State is opaque to the db package.
+type SavedGame struct {
+    GameID    int
+    GuildID   string
+    ChannelID string
+    State     string
+    SavedAt   time.Time
+}
+
+// APIToken is a bearer token for the HTTP API. Only its hash is stored.
+type APIToken struct {
+    ID         int
+    Name       string
+    Hash       string
+    CreatedAt  time.Time
+    LastUsedAt time.Time // Zero if never used
+}
+
+// Attempt is one player's answer to a question, right or wrong.
+type Attempt struct {
+    GameID      int
+    GuildID     string
+    QuestionID  int
+    UserID      string
+    Answer      string        // As typed, or the option picked for multiple choice
+    Correct     bool
+    Latency     time.Duration // Time since the question was posted
+    AttemptedAt time.Time
+}
+
+// QuestionStats summarizes the attempts at a question.
+type QuestionStats struct {
+    QuestionID    int
+    Attempts      int
+    Correct       int
+    MedianLatency time.Duration // Zero without attempts
+    WrongAnswers  []AnswerCount // Most common first, only filled in by GetQuestionStats
+}
+
+// CorrectRate is the fraction of attempts that were correct.
+func (s QuestionStats) CorrectRate() float64 {
+    if s.Attempts == 0 {
+        return 0
+    }
+    return float64(s.Correct) / float64(s.Attempts)
+}
+
+// AnswerCount is how often a wrong answer was given, compared ignoring case.
+type AnswerCount struct {
+    Answer string
+    Count  int
+}
+
+// Profile is a player's lifetime record in a guild.
+type Profile struct {
+    GuildID          string
+    UserID           string
+    Team             string // Empty if the player hasn't joined one
+    Points           int // Earned in games, so score adjustments through the API don't count
+    Games            int // Games the player answered or scored in
+    Wins             int // Ended games the player was top scorer of, including ties
+    Attempts         int
+    Correct          int
+    Fastest          time.Duration // Quickest correct answer, zero without any
+    LongestStreak    int           // Most correct answers in a row
+    FavoriteCategory string        // Category with the most correct answers
+}
+
+// Accuracy is the fraction of the player's answers that were correct.
+func (p Profile) Accuracy() float64 {
+    if p.Attempts == 0 {
+        return 0
+    }
+    return float64(p.Correct) / float64(p.Attempts)
+}
+
+// Achievement is a badge players unlock when one of their stats reaches a
+// threshold. Metric is one of the measures the bot knows how to judge.
+type Achievement struct {
+    Key         string // Short unique ID, e.g. "five_in_a_row"
+    Name        string
+    Description string
+    Metric      string
+    Threshold   int
+}
+
+// DefaultAchievements are created along with the achievements table. Admins
+// can add and remove achievements afterwards; editing this list doesn't
+// change existing databases.
+var DefaultAchievements = []Achievement{
+    {Key: "first_blood", Name: "First Blood", Description: "Answer a question correctly", Metric: "correct", Threshold: 1},
+    {Key: "five_in_a_row", Name: "5 in a Row", Description: "Answer 5 questions correctly in a row", Metric: "streak", Threshold: 5},
+    {Key: "quick_draw", Name: "Quick Draw", Description: "Answer correctly in under 3 seconds", Metric: "fastest", Threshold: 3},
+    {Key: "perfect_game", Name: "Perfect Game", Description: "Answer every question of a game of at least 5 questions correctly", Metric: "perfect_game", Threshold: 5},
+    {Key: "centurion", Name: "Centurion", Description: "Answer 100 questions correctly", Metric: "correct", Threshold: 100},
+}
+
+// UserAchievement is an achievement a player unlocked in a guild.
+type UserAchievement struct {
+    Achievement
+    GuildID    string
+    UserID     string
+    GameID     int // Game it was unlocked in
+    UnlockedAt time.Time
+}
+
+type CategoryCount struct {
+    Category string
+    Count    int
+}
+
+func (q *Question) IsChoice() bool {
+    return q.Kind == KindChoice
+}
+
+// Validate checks that a question can be asked.
+func (q *Question) Validate() error {
+    if strings.TrimSpace(q.Text) == "" || strings.TrimSpace(q.Answer) == "" {
+        return fmt.Errorf("the question and answer can't be empty")
+    }
+    if _, ok := difficultyNames[q.Difficulty]; !ok && q.Difficulty != 0 {
+        return fmt.Errorf("difficulty must be 1 (easy) to 3 (hard), not %d", q.Difficulty)
+    }
+
+    switch q.Kind {
+    case KindText, "":
+        if len(q.Distractors) > 0 {
+            return fmt.Errorf("only multiple-choice questions can have wrong answers")
+        }
+    case KindChoice:
+        if len(q.Distractors) == 0 || len(q.Distractors) > MaxDistractors {
+            return fmt.Errorf("multiple-choice questions need 1 to %d wrong answers", MaxDistractors)
+        }
+        for _, wrong := range q.Distractors {
+            if strings.TrimSpace(wrong) == "" || strings.EqualFold(strings.TrimSpace(wrong), strings.TrimSpace(q.Answer)) {
+                return fmt.Errorf("wrong answers can't be empty or the same as the correct answer")
+            }
+        }
+    default:
+        return fmt.Errorf("unknown question kind %q, expected %s or %s", q.Kind, KindText, KindChoice)
+    }
+    return nil
+}
+
+// normalize trims the question and fills in the default kind and difficulty
+// before it is stored.
+func (q *Question) normalize() {
+    q.Text = strings.TrimSpace(q.Text)
+    q.Answer = strings.TrimSpace(q.Answer)
+    q.Category = strings.TrimSpace(q.Category)
+    if q.Kind == "" {
+        q.Kind = KindText
+    }
+    if q.Difficulty == 0 {
+        q.Difficulty = DifficultyMedium
+    }
+}
+
+// AcceptedAnswers returns the answer followed by its aliases.
+func (q *Question) AcceptedAnswers() []string {
+    return append([]string{q.Answer}, q.Aliases...)
 }
 
 type Player struct {
+    GuildID  string
     UserID   string
     Team     string
     Score    int
 }
 
 type Team struct {
+    GuildID  string
     Name     string
     Score    int
 }
@@ -0,0 +1,105 @@
+package db
+
+import (
+    "database/sql"
+    "strings"
+    "time"
+)
+
+// GetProfile gathers a player's lifetime record in a guild. A player with no
+// history gets an empty profile rather than an error.
+func (db *DB) GetProfile(guildID, userID string) (*Profile, error) {
+    p := &Profile{GuildID: guildID, UserID: userID}
+    err := db.QueryRow("SELECT team FROM players WHERE guild_id = ? AND user_id = ?", guildID, userID).Scan(&p.Team)
+    if err != nil && err != sql.ErrNoRows {
+        return nil, err
+    }
+    p.Team = strings.TrimSpace(p.Team)
+
+    // players.score starts over on joining a team or a reset, so lifetime
+    // points come from the game scoreboards
+    err = db.QueryRow(`SELECT COALESCE(SUM(s.score), 0) FROM game_scores s JOIN games g ON g.id = s.game_id
+        WHERE g.guild_id = ? AND s.user_id = ?`, guildID, userID).Scan(&p.Points)
+    if err != nil {
+        return nil, err
+    }
+
+    err = db.QueryRow(`SELECT COUNT(*) FROM (
+            SELECT game_id FROM answer_attempts WHERE guild_id = ? AND user_id = ?
+            UNION
+            SELECT s.game_id FROM game_scores s JOIN games g ON g.id = s.game_id WHERE g.guild_id = ? AND s.user_id = ?
+        )`, guildID, userID, guildID, userID).Scan(&p.Games)
+    if err != nil {
+        return nil, err
+    }
+
+    err = db.QueryRow(`SELECT COUNT(*) FROM game_scores s JOIN games g ON g.id = s.game_id
+        WHERE g.guild_id = ? AND s.user_id = ? AND g.ended_at IS NOT NULL AND s.score > 0
+            AND s.score = (SELECT MAX(score) FROM game_scores WHERE game_id = s.game_id)`, guildID, userID).Scan(&p.Wins)
+    if err != nil {
+        return nil, err
+    }
+
+    rows, err := db.Query(`SELECT a.correct, a.latency_ms, COALESCE(q.category, '') FROM answer_attempts a
+        LEFT JOIN questions q ON q.id = a.question_id
+        WHERE a.guild_id = ? AND a.user_id = ? ORDER BY a.id`, guildID, userID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var attempts []profileAttempt
+    for rows.Next() {
+        var a profileAttempt
+        var latency int64
+        if err := rows.Scan(&a.correct, &latency, &a.category); err != nil {
+            return nil, err
+        }
+        a.latency = time.Duration(latency) * time.Millisecond
+        attempts = append(attempts, a)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+    p.addAttempts(attempts)
+    return p, nil
+}
+
+// profileAttempt is the part of an attempt a profile needs, with the
+// category of its question ("" if the question was removed).
+type profileAttempt struct {
+    correct  bool
+    latency  time.Duration
+    category string
+}
+
+// addAttempts fills in the answer statistics from a player's attempts,
+// oldest first. Both stores use it so they agree on streaks and favorites.
+func (p *Profile) addAttempts(attempts []profileAttempt) {
+    streak, favoriteCount := 0, 0
+    correctByCategory := make(map[string]int) // Categories compare ignoring case
+    for _, a := range attempts {
+        p.Attempts++
+        if !a.correct {
+            streak = 0
+            continue
+        }
+        p.Correct++
+        if p.Fastest == 0 || a.latency < p.Fastest {
+            p.Fastest = a.latency
+        }
+        streak++
+        if streak > p.LongestStreak {
+            p.LongestStreak = streak
+        }
+        if a.category == "" {
+            continue
+        }
+        key := strings.ToLower(a.category)
+        correctByCategory[key]++
+        if correctByCategory[key] > favoriteCount {
+            favoriteCount = correctByCategory[key]
+            p.FavoriteCategory = a.category
+        }
+    }
+}
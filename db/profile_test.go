@@ -0,0 +1,76 @@
+package db
+
+import (
+    "path/filepath"
+    "testing"
+)
+
+// stores returns a fresh SQLite and in-memory store, so tests can check
+// that both behave the same.
+func stores(t *testing.T) map[string]Store {
+    t.Helper()
+    sqlite, err := NewDB(filepath.Join(t.TempDir(), "trivia.db"), "")
+    if err != nil {
+        t.Fatalf("opening database: %v", err)
+    }
+    memory := NewMemory()
+    t.Cleanup(func() {
+        sqlite.Close()
+        memory.Close()
+    })
+    return map[string]Store{"sqlite": sqlite, "memory": memory}
+}
+
+func TestProfilePointsSurviveTeamChangesAndResets(t *testing.T) {
+    const guild, user = "g1", "u1"
+    for name, store := range stores(t) {
+        t.Run(name, func(t *testing.T) {
+            points := func() int {
+                t.Helper()
+                p, err := store.GetProfile(guild, user)
+                if err != nil {
+                    t.Fatalf("profile: %v", err)
+                }
+                return p.Points
+            }
+            mustDo := func(err error) {
+                t.Helper()
+                if err != nil {
+                    t.Fatal(err)
+                }
+            }
+
+            mustDo(store.JoinTeam(guild, user, "red"))
+            first, err := store.StartGame(guild, "c1", "admin", "classic")
+            mustDo(err)
+            mustDo(store.AddScore(guild, first, user, "red", 10))
+            mustDo(store.AddScore(guild, first, user, "red", 20))
+            if got := points(); got != 30 {
+                t.Errorf("after scoring: %d points, want 30", got)
+            }
+
+            mustDo(store.JoinTeam(guild, user, "blue"))
+            if got := points(); got != 30 {
+                t.Errorf("after switching teams: %d points, want 30", got)
+            }
+
+            mustDo(store.ResetScoresAndTeams(guild))
+            mustDo(store.JoinTeam(guild, user, "blue"))
+            second, err := store.StartGame(guild, "c1", "admin", "classic")
+            mustDo(err)
+            mustDo(store.AddScore(guild, second, user, "blue", 5))
+            if got := points(); got != 35 {
+                t.Errorf("after a reset: %d points, want 35", got)
+            }
+
+            // Adjustments outside a game and other guilds don't count
+            mustDo(store.AddScore(guild, 0, user, "blue", 100))
+            other, err := store.StartGame("g2", "c2", "admin", "classic")
+            mustDo(err)
+            mustDo(store.AddScore("g2", other, user, "", 50))
+            if got := points(); got != 35 {
+                t.Errorf("with adjustments and other guilds: %d points, want 35", got)
+            }
+        })
+    }
+}
@@ -0,0 +1,32 @@
+package db
+
+// GetGuildSettings returns the settings a guild has changed, by key.
+func (db *DB) GetGuildSettings(guildID string) (map[string]string, error) {
+    rows, err := db.Query("SELECT key, value FROM guild_settings WHERE guild_id = ?", guildID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    settings := make(map[string]string)
+    for rows.Next() {
+        var key, value string
+        if err := rows.Scan(&key, &value); err != nil {
+            return nil, err
+        }
+        settings[key] = value
+    }
+    return settings, rows.Err()
+}
+
+func (db *DB) SetGuildSetting(guildID, key, value string) error {
+    _, err := db.Exec(`INSERT INTO guild_settings (guild_id, key, value) VALUES (?, ?, ?)
+        ON CONFLICT (guild_id, key) DO UPDATE SET value = excluded.value`, guildID, key, value)
+    return err
+}
+
+// ResetGuildSetting removes a guild's value so the default applies again.
+func (db *DB) ResetGuildSetting(guildID, key string) error {
+    _, err := db.Exec("DELETE FROM guild_settings WHERE guild_id = ? AND key = ?", guildID, key)
+    return err
+}
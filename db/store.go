@@ -0,0 +1,90 @@
+package db
+
+import (
+    "fmt"
+    "log"
+)
+
+// Store is every storage operation the bot needs. DB keeps everything in
+// SQLite; Memory keeps it in process for tests and throwaway deployments.
+// Lookups that find nothing return sql.ErrNoRows from either one.
+type Store interface {
+    // Question bank
+    AddQuestion(q *Question) error
+    UpdateQuestion(q *Question) error
+    GetQuestion(id int) (*Question, error)
+    ImportQuestions(questions []*Question) error
+    RemoveQuestion(id int) error
+    GetRandomQuestion(filter QuestionFilter, exclude Exclusion) (*Question, error)
+    ListQuestions() ([]Question, error)
+    ListCategories() ([]CategoryCount, error)
+
+    // Players, teams and all-time scores
+    JoinTeam(guildID, userID, team string) error
+    GetPlayerTeam(guildID, userID string) (string, error)
+    AddScore(guildID string, gameID int, userID, team string, points int) error
+    GetScores(guildID string) ([]Player, []Team, error)
+    GetProfile(guildID, userID string) (*Profile, error)
+    ResetScoresAndTeams(guildID string) error
+
+    // Game sessions
+    StartGame(guildID, channelID, startedBy, rules string) (int, error)
+    EndGame(gameID int, reason string, questions int) error
+    GetGame(gameID int) (*Game, error)
+    LatestGame(guildID string) (*Game, error)
+    ListGames(guildID string, limit int) ([]Game, error)
+    GetGameScores(gameID int) ([]Player, []Team, error)
+    RecordAskedQuestion(guildID string, gameID, questionID int) error
+    SaveGameState(g *SavedGame) error
+    ListGameStates() ([]SavedGame, error)
+    DeleteGameState(gameID int) error
+
+    // Answer attempts, for question statistics
+    RecordAttempt(a *Attempt) error
+    GetQuestionStats(questionID int) (*QuestionStats, error)
+    ListQuestionStats() ([]QuestionStats, error)
+    ListGameAttempts(gameID int) ([]Attempt, error)
+
+    // Achievements, defined for every guild and unlocked per guild
+    ListAchievements() ([]Achievement, error)
+    AddAchievement(a *Achievement) error
+    RemoveAchievement(key string) error
+    UnlockAchievement(guildID, userID, key string, gameID int) (bool, error)
+    ListUserAchievements(guildID, userID string) ([]UserAchievement, error)
+
+    // Per-guild settings, stored as text by key
+    GetGuildSettings(guildID string) (map[string]string, error)
+    SetGuildSetting(guildID, key, value string) error
+    ResetGuildSetting(guildID, key string) error
+
+    // HTTP API tokens, looked up by hash
+    CreateAPIToken(name, hash string) (int, error)
+    UseAPIToken(hash string) (*APIToken, error)
+    ListAPITokens() ([]APIToken, error)
+    RevokeAPIToken(id int) error
+
+    Close() error
+}
+
+var (
+    _ Store = (*DB)(nil)
+    _ Store = (*Memory)(nil)
+)
+
+// NewStore opens a storage backend: "sqlite", using the database at path, or
+// "memory".
+func NewStore(backend, path, defaultGuildID string) (Store, error) {
+    switch backend {
+    case "sqlite":
+        db, err := NewDB(path, defaultGuildID)
+        if err != nil {
+            return nil, err
+        }
+        return db, nil
+    case "memory":
+        log.Println("Using in-memory storage; questions and scores are lost when the bot stops")
+        return NewMemory(), nil
+    default:
+        return nil, fmt.Errorf("unknown storage backend %q, expected sqlite or memory", backend)
+    }
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+    "database/sql"
+    "time"
+)
+
+// CreateAPIToken stores the hash of a new API token and returns its ID.
+func (db *DB) CreateAPIToken(name, hash string) (int, error) {
+    res, err := db.Exec("INSERT INTO api_tokens (name, hash, created_at) VALUES (?, ?, ?)", name, hash, time.Now().UTC())
+    if err != nil {
+        return 0, err
+    }
+    id, err := res.LastInsertId()
+    return int(id), err
+}
+
+// UseAPIToken finds the token with the given hash and records that it was used.
+func (db *DB) UseAPIToken(hash string) (*APIToken, error) {
+    t, err := scanAPIToken(db.QueryRow("SELECT id, name, hash, created_at, last_used_at FROM api_tokens WHERE hash = ?", hash))
+    if err != nil {
+        return nil, err
+    }
+    t.LastUsedAt = time.Now().UTC()
+    if _, err := db.Exec("UPDATE api_tokens SET last_used_at = ? WHERE id = ?", t.LastUsedAt, t.ID); err != nil {
+        return nil, err
+    }
+    return t, nil
+}
+
+func (db *DB) ListAPITokens() ([]APIToken, error) {
+    rows, err := db.Query("SELECT id, name, hash, created_at, last_used_at FROM api_tokens ORDER BY id")
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var tokens []APIToken
+    for rows.Next() {
+        t, err := scanAPIToken(rows)
+        if err != nil {
+            return nil, err
+        }
+        tokens = append(tokens, *t)
+    }
+    return tokens, rows.Err()
+}
+
+// RevokeAPIToken deletes a token. It returns sql.ErrNoRows if there is none with the ID.
+func (db *DB) RevokeAPIToken(id int) error {
+    res, err := db.Exec("DELETE FROM api_tokens WHERE id = ?", id)
+    if err != nil {
+        return err
+    }
+    if n, err := res.RowsAffected(); err == nil && n == 0 {
+        return sql.ErrNoRows
+    }
+    return err
+}
+
+func scanAPIToken(row rowScanner) (*APIToken, error) {
+    var t APIToken
+    var lastUsed sql.NullTime
+    if err := row.Scan(&t.ID, &t.Name, &t.Hash, &t.CreatedAt, &lastUsed); err != nil {
+        return nil, err
+    }
+    t.LastUsedAt = lastUsed.Time
+    return &t, nil
+}
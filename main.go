@@ -1,19 +1,229 @@
 package main
 
 import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
     "log"
+    "net/http"
+    "os"
+    "os/signal"
+    "strconv"
+    "strings"
+    "syscall"
+
     "github.com/airylvat/trivia-bot/bot"
+    "github.com/airylvat/trivia-bot/config"
+    "github.com/airylvat/trivia-bot/db"
+    "github.com/airylvat/trivia-bot/metrics"
+    "github.com/airylvat/trivia-bot/web"
+)
+
+const (
+    migrateUsage = "usage: trivia-bot migrate [status|up]"
+    tokenUsage   = "usage: trivia-bot token [list|create <name>|revoke <id>]"
+    usage        = "usage: trivia-bot [migrate [status|up] | token [list|create <name>|revoke <id>]]"
 )
 
 func main() {
-    bot, err := bot.NewBot()
+    cfg, err := config.Load()
     if err != nil {
         log.Fatal(err)
     }
 
+    if len(os.Args) > 1 {
+        switch os.Args[1] {
+        case "migrate":
+            err = runMigrate(cfg, os.Args[2:])
+        case "token":
+            err = runToken(cfg, os.Args[2:])
+        default:
+            err = fmt.Errorf(usage)
+        }
+        if err != nil {
+            log.Fatal(err)
+        }
+        return
+    }
+
+    for _, line := range cfg.Diagnostics() {
+        log.Println(line)
+    }
+
+    bot, err := bot.NewBot(cfg)
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    // Servers to stop before the bot on shutdown
+    var servers []interface{ Shutdown(context.Context) error }
+
+    if cfg.APIAddress != "" {
+        api := web.NewServer(bot.DB, bot, cfg.PublicURL)
+        bot.Dashboard = api
+        servers = append(servers, api)
+        go func() {
+            if err := api.ListenAndServe(cfg.APIAddress); err != nil && !errors.Is(err, http.ErrServerClosed) {
+                log.Printf("HTTP API stopped: %v", err)
+            }
+        }()
+    }
+
+    if cfg.MetricsAddress != "" {
+        bot.RegisterMetrics()
+        srv := metrics.NewServer(cfg.MetricsAddress)
+        servers = append(servers, srv)
+        go func() {
+            log.Printf("Metrics listening on %s/metrics", cfg.MetricsAddress)
+            if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+                log.Printf("Metrics server stopped: %v", err)
+            }
+        }()
+    }
+
+    // Stop on Ctrl+C or `docker stop`
+    stop, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer cancel()
+
     if err := bot.Start(); err != nil {
         log.Fatal(err)
     }
 
-    select {} // Keep bot running
+    <-stop.Done()
+    cancel() // A second signal kills the process
+    log.Printf("Received shutdown signal, waiting up to %s for commands and games", cfg.DrainTimeout)
+
+    ctx, cancelDrain := context.WithTimeout(context.Background(), cfg.DrainTimeout)
+    defer cancelDrain()
+    for _, srv := range servers {
+        if err := srv.Shutdown(ctx); err != nil {
+            log.Printf("Error stopping HTTP server: %v", err)
+        }
+    }
+    if err := bot.Shutdown(ctx); err != nil {
+        log.Fatal(err)
+    }
+}
+
+// runMigrate shows or applies pending schema migrations without connecting
+// to Discord.
+func runMigrate(cfg *config.Config, args []string) error {
+    action := "status"
+    if len(args) > 0 {
+        action = args[0]
+    }
+    if len(args) > 1 || (action != "status" && action != "up") {
+        return fmt.Errorf(migrateUsage)
+    }
+
+    database, err := db.Open(cfg.DatabasePath)
+    if err != nil {
+        return err
+    }
+    defer database.Close()
+    database.DefaultGuildID = cfg.DefaultGuildID
+
+    version, err := database.SchemaVersion()
+    if err != nil {
+        return err
+    }
+    pending, err := database.PendingMigrations()
+    if err != nil {
+        return err
+    }
+
+    if action == "up" {
+        if len(pending) == 0 {
+            fmt.Printf("Schema is up to date at version %d.\n", version)
+            return nil
+        }
+        applied, err := database.Migrate()
+        for _, m := range applied {
+            fmt.Printf("Applied %d: %s\n", m.Version, m.Description)
+        }
+        if err != nil {
+            return err
+        }
+        fmt.Printf("Schema is now at version %d.\n", db.LatestVersion())
+        return nil
+    }
+
+    fmt.Printf("Schema version: %d (latest %d)\n", version, db.LatestVersion())
+    if len(pending) == 0 {
+        fmt.Println("No pending migrations.")
+        return nil
+    }
+    fmt.Printf("%d pending migration(s):\n", len(pending))
+    for _, m := range pending {
+        fmt.Printf("  %d: %s\n", m.Version, m.Description)
+    }
+    return nil
+}
+
+// runToken manages the bearer tokens accepted by the HTTP API. New tokens
+// are printed once; only their hashes are stored.
+func runToken(cfg *config.Config, args []string) error {
+    if cfg.Storage != "sqlite" {
+        return fmt.Errorf("API tokens are stored in the database, so they need sqlite storage")
+    }
+    action := "list"
+    if len(args) > 0 {
+        action = args[0]
+    }
+
+    database, err := db.NewDB(cfg.DatabasePath, cfg.DefaultGuildID)
+    if err != nil {
+        return err
+    }
+    defer database.Close()
+
+    switch {
+    case action == "list" && len(args) <= 1:
+        tokens, err := database.ListAPITokens()
+        if err != nil {
+            return err
+        }
+        if len(tokens) == 0 {
+            fmt.Println("No API tokens.")
+            return nil
+        }
+        for _, t := range tokens {
+            used := "never used"
+            if !t.LastUsedAt.IsZero() {
+                used = "last used " + t.LastUsedAt.Format("2006-01-02 15:04")
+            }
+            fmt.Printf("%d: %s (created %s, %s)\n", t.ID, t.Name, t.CreatedAt.Format("2006-01-02"), used)
+        }
+        return nil
+
+    case action == "create" && len(args) > 1:
+        name := strings.Join(args[1:], " ")
+        token, hash, err := web.NewToken()
+        if err != nil {
+            return err
+        }
+        id, err := database.CreateAPIToken(name, hash)
+        if err != nil {
+            return err
+        }
+        fmt.Printf("Created token %d (%s). Store it now, it won't be shown again:\n%s\n", id, name, token)
+        return nil
+
+    case action == "revoke" && len(args) == 2:
+        id, err := strconv.Atoi(args[1])
+        if err != nil {
+            return fmt.Errorf(tokenUsage)
+        }
+        err = database.RevokeAPIToken(id)
+        if errors.Is(err, sql.ErrNoRows) {
+            return fmt.Errorf("no API token with ID %d", id)
+        }
+        if err != nil {
+            return fmt.Errorf("revoking token %d: %w", id, err)
+        }
+        fmt.Printf("Revoked token %d.\n", id)
+        return nil
+    }
+    return fmt.Errorf(tokenUsage)
 }
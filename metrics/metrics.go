@@ -0,0 +1,84 @@
+// Package metrics defines the bot's Prometheus metrics and serves them on
+// /metrics.
+package metrics
+
+import (
+    "net/http"
+    "time"
+
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/promauto"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Command outcomes
+const (
+    OutcomeOK           = "ok"
+    OutcomeError        = "error"         // The command replied with an error
+    OutcomeForbidden    = "forbidden"     // An admin command used by someone else
+    OutcomeWrongChannel = "wrong_channel" // Used outside the allowed channels
+)
+
+// Answer results
+const (
+    Correct   = "correct"
+    Incorrect = "incorrect"
+)
+
+var (
+    Commands = promauto.NewCounterVec(prometheus.CounterOpts{
+        Name: "trivia_commands_total",
+        Help: "Commands handled, by command name and outcome.",
+    }, []string{"command", "outcome"})
+
+    Answers = promauto.NewCounterVec(prometheus.CounterOpts{
+        Name: "trivia_answers_total",
+        Help: "Answers submitted, typed or picked with a button, by result.",
+    }, []string{"result"})
+
+    GamesStarted = promauto.NewCounter(prometheus.CounterOpts{
+        Name: "trivia_games_started_total",
+        Help: "Games started.",
+    })
+
+    GamesEnded = promauto.NewCounterVec(prometheus.CounterOpts{
+        Name: "trivia_games_ended_total",
+        Help: "Games ended, by reason.",
+    }, []string{"reason"})
+
+    SendErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+        Name: "trivia_discord_send_errors_total",
+        Help: "Failed Discord API calls that send or edit messages, by call.",
+    }, []string{"call"})
+
+    TimeToFirstCorrect = promauto.NewHistogram(prometheus.HistogramOpts{
+        Name:    "trivia_time_to_first_correct_seconds",
+        Help:    "Time from a question being posted to its first correct answer.",
+        Buckets: []float64{1, 2, 3, 5, 8, 10, 15, 20, 30, 45, 60, 90, 120, 300},
+    })
+)
+
+// RegisterGauges adds the gauges that are read from the running bot when
+// scraped: active games and the size of the question bank.
+func RegisterGauges(activeGames, bankSize func() float64) {
+    promauto.NewGaugeFunc(prometheus.GaugeOpts{
+        Name: "trivia_active_games",
+        Help: "Games currently running.",
+    }, activeGames)
+    promauto.NewGaugeFunc(prometheus.GaugeOpts{
+        Name: "trivia_questions",
+        Help: "Questions in the bank.",
+    }, bankSize)
+}
+
+// NewServer returns a server for /metrics on addr. Run it with
+// ListenAndServe and stop it with Shutdown.
+func NewServer(addr string) *http.Server {
+    mux := http.NewServeMux()
+    mux.Handle("GET /metrics", promhttp.Handler())
+    return &http.Server{
+        Addr:              addr,
+        Handler:           mux,
+        ReadHeaderTimeout: 10 * time.Second,
+    }
+}
@@ -0,0 +1,419 @@
+package web
+
+import (
+    "database/sql"
+    "errors"
+    "fmt"
+    "net/http"
+    "slices"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/airylvat/trivia-bot/bank"
+    "github.com/airylvat/trivia-bot/db"
+)
+
+const (
+    defaultGameLimit = 20
+    maxGameLimit     = 100
+)
+
+type gameJSON struct {
+    ID          int        `json:"id"`
+    GuildID     string     `json:"guild_id"`
+    ChannelID   string     `json:"channel_id"`
+    StartedBy   string     `json:"started_by"`
+    StartedAt   time.Time  `json:"started_at"`
+    EndedAt     *time.Time `json:"ended_at,omitempty"`
+    EndReason   string     `json:"end_reason,omitempty"`
+    Rules       string     `json:"rules"`
+    Questions   int        `json:"questions"`
+    WinnerID    string     `json:"winner_id,omitempty"`
+    WinnerScore int        `json:"winner_score,omitempty"`
+    Running     bool       `json:"running"`
+}
+
+type playerJSON struct {
+    UserID string `json:"user_id"`
+    Team   string `json:"team"`
+    Score  int    `json:"score"`
+}
+
+type teamJSON struct {
+    Name  string `json:"name"`
+    Score int    `json:"score"`
+}
+
+type scoreboardJSON struct {
+    Players []playerJSON `json:"players"`
+    Teams   []teamJSON   `json:"teams"`
+}
+
+func toGameJSON(g db.Game, running []int) gameJSON {
+    j := gameJSON{
+        ID:          g.ID,
+        GuildID:     g.GuildID,
+        ChannelID:   g.ChannelID,
+        StartedBy:   g.StartedBy,
+        StartedAt:   g.StartedAt,
+        EndReason:   g.EndReason,
+        Rules:       g.Rules,
+        Questions:   g.Questions,
+        WinnerID:    g.WinnerID,
+        WinnerScore: g.WinnerScore,
+        Running:     slices.Contains(running, g.ID),
+    }
+    if !g.EndedAt.IsZero() {
+        j.EndedAt = &g.EndedAt
+    }
+    return j
+}
+
+func toScoreboard(players []db.Player, teams []db.Team) scoreboardJSON {
+    board := scoreboardJSON{Players: []playerJSON{}, Teams: []teamJSON{}}
+    for _, p := range players {
+        board.Players = append(board.Players, playerJSON{UserID: p.UserID, Team: p.Team, Score: p.Score})
+    }
+    for _, t := range teams {
+        board.Teams = append(board.Teams, teamJSON{Name: t.Name, Score: t.Score})
+    }
+    return board
+}
+
+// pathID reads a numeric path parameter, answering 404 if it isn't one.
+func pathID(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+    id, err := strconv.Atoi(r.PathValue(name))
+    if err != nil || id < 1 {
+        writeError(w, http.StatusNotFound, "not found")
+        return 0, false
+    }
+    return id, true
+}
+
+// matchesSearch reports whether the search text appears in any of the
+// question's text fields, ignoring case.
+func matchesSearch(q *db.Question, search string) bool {
+    if search == "" {
+        return true
+    }
+    fields := append([]string{q.Text, q.Answer, q.Category}, q.Distractors...)
+    fields = append(fields, q.Aliases...)
+    fields = append(fields, q.Tags...)
+    for _, field := range fields {
+        if strings.Contains(strings.ToLower(field), search) {
+            return true
+        }
+    }
+    return false
+}
+
+// listQuestions returns the bank, optionally filtered by the category, tag
+// and difficulty query parameters and searched with q.
+func (s *Server) listQuestions(w http.ResponseWriter, r *http.Request) {
+    query := r.URL.Query()
+    search := strings.ToLower(strings.TrimSpace(query.Get("q")))
+    filter := db.QuestionFilter{Category: query.Get("category"), Tag: query.Get("tag")}
+    if d := query.Get("difficulty"); d != "" {
+        difficulty, err := db.ParseDifficulty(d)
+        if err != nil {
+            writeError(w, http.StatusBadRequest, err.Error())
+            return
+        }
+        filter.Difficulty = difficulty
+    }
+
+    questions, err := s.DB.ListQuestions()
+    if err != nil {
+        internalError(w, err)
+        return
+    }
+    records := []bank.Record{}
+    for _, q := range questions {
+        if filter.Matches(&q) && matchesSearch(&q, search) {
+            records = append(records, bank.ToRecord(q))
+        }
+    }
+    writeJSON(w, http.StatusOK, records)
+}
+
+func (s *Server) getQuestion(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r, "id")
+    if !ok {
+        return
+    }
+    q, err := s.DB.GetQuestion(id)
+    if errors.Is(err, sql.ErrNoRows) {
+        writeError(w, http.StatusNotFound, "question not found")
+        return
+    }
+    if err != nil {
+        internalError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, bank.ToRecord(*q))
+}
+
+// readQuestion decodes and validates a question from the request body.
+func readQuestion(w http.ResponseWriter, r *http.Request) (*db.Question, bool) {
+    var rec bank.Record
+    if !readJSON(w, r, &rec) {
+        return nil, false
+    }
+    q, err := bank.ToQuestion(rec)
+    if err != nil {
+        writeError(w, http.StatusUnprocessableEntity, err.Error())
+        return nil, false
+    }
+    return q, true
+}
+
+func (s *Server) createQuestion(w http.ResponseWriter, r *http.Request) {
+    q, ok := readQuestion(w, r)
+    if !ok {
+        return
+    }
+    if err := s.DB.AddQuestion(q); err != nil {
+        internalError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusCreated, bank.ToRecord(*q))
+}
+
+func (s *Server) updateQuestion(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r, "id")
+    if !ok {
+        return
+    }
+    q, ok := readQuestion(w, r)
+    if !ok {
+        return
+    }
+    q.ID = id
+    err := s.DB.UpdateQuestion(q)
+    if errors.Is(err, sql.ErrNoRows) {
+        writeError(w, http.StatusNotFound, "question not found")
+        return
+    }
+    if err != nil {
+        internalError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, bank.ToRecord(*q))
+}
+
+func (s *Server) deleteQuestion(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r, "id")
+    if !ok {
+        return
+    }
+    if _, err := s.DB.GetQuestion(id); errors.Is(err, sql.ErrNoRows) {
+        writeError(w, http.StatusNotFound, "question not found")
+        return
+    } else if err != nil {
+        internalError(w, err)
+        return
+    }
+    if err := s.DB.RemoveQuestion(id); err != nil {
+        internalError(w, err)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// tagQuestions adds and removes tags on several questions at once. Nothing
+// is saved unless every question exists.
+func (s *Server) tagQuestions(w http.ResponseWriter, r *http.Request) {
+    var body struct {
+        IDs    []int    `json:"ids"`
+        Add    []string `json:"add"`
+        Remove []string `json:"remove"`
+    }
+    if !readJSON(w, r, &body) {
+        return
+    }
+    if len(body.IDs) == 0 || len(body.Add)+len(body.Remove) == 0 {
+        writeError(w, http.StatusBadRequest, "give ids and tags to add or remove")
+        return
+    }
+
+    var questions []*db.Question
+    for _, id := range body.IDs {
+        q, err := s.DB.GetQuestion(id)
+        if errors.Is(err, sql.ErrNoRows) {
+            writeError(w, http.StatusNotFound, fmt.Sprintf("question %d not found", id))
+            return
+        }
+        if err != nil {
+            internalError(w, err)
+            return
+        }
+        q.Tags = slices.DeleteFunc(q.Tags, func(tag string) bool {
+            return slices.ContainsFunc(body.Remove, func(remove string) bool {
+                return strings.EqualFold(tag, strings.TrimSpace(remove))
+            })
+        })
+        for _, tag := range body.Add {
+            tag = strings.TrimSpace(tag)
+            exists := slices.ContainsFunc(q.Tags, func(t string) bool { return strings.EqualFold(t, tag) })
+            if tag != "" && !exists {
+                q.Tags = append(q.Tags, tag)
+            }
+        }
+        questions = append(questions, q)
+    }
+
+    // ImportQuestions saves them all in one transaction
+    if err := s.DB.ImportQuestions(questions); err != nil {
+        internalError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]int{"updated": len(questions)})
+}
+
+func (s *Server) listCategories(w http.ResponseWriter, r *http.Request) {
+    categories, err := s.DB.ListCategories()
+    if err != nil {
+        internalError(w, err)
+        return
+    }
+    type categoryJSON struct {
+        Category string `json:"category"`
+        Count    int    `json:"count"`
+    }
+    list := []categoryJSON{}
+    for _, c := range categories {
+        list = append(list, categoryJSON{c.Category, c.Count})
+    }
+    writeJSON(w, http.StatusOK, list)
+}
+
+// listGames returns a guild's recent games, newest first. The limit query
+// parameter picks how many (default 20, at most 100).
+func (s *Server) listGames(w http.ResponseWriter, r *http.Request) {
+    limit := defaultGameLimit
+    if l := r.URL.Query().Get("limit"); l != "" {
+        n, err := strconv.Atoi(l)
+        if err != nil || n < 1 || n > maxGameLimit {
+            writeError(w, http.StatusBadRequest, "limit must be 1 to 100")
+            return
+        }
+        limit = n
+    }
+
+    games, err := s.DB.ListGames(r.PathValue("guild"), limit)
+    if err != nil {
+        internalError(w, err)
+        return
+    }
+    running := s.Games.RunningGames()
+    list := []gameJSON{}
+    for _, g := range games {
+        list = append(list, toGameJSON(g, running))
+    }
+    writeJSON(w, http.StatusOK, list)
+}
+
+// getGame returns a game with its scoreboard.
+func (s *Server) getGame(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r, "id")
+    if !ok {
+        return
+    }
+    g, err := s.DB.GetGame(id)
+    if errors.Is(err, sql.ErrNoRows) {
+        writeError(w, http.StatusNotFound, "game not found")
+        return
+    }
+    if err != nil {
+        internalError(w, err)
+        return
+    }
+    players, teams, err := s.DB.GetGameScores(id)
+    if err != nil {
+        internalError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, struct {
+        gameJSON
+        Scores scoreboardJSON `json:"scores"`
+    }{toGameJSON(*g, s.Games.RunningGames()), toScoreboard(players, teams)})
+}
+
+func (s *Server) endGame(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r, "id")
+    if !ok {
+        return
+    }
+    if _, err := s.DB.GetGame(id); errors.Is(err, sql.ErrNoRows) {
+        writeError(w, http.StatusNotFound, "game not found")
+        return
+    } else if err != nil {
+        internalError(w, err)
+        return
+    }
+    if err := s.Games.EndGame(id); err != nil {
+        writeError(w, http.StatusConflict, err.Error())
+        return
+    }
+
+    g, err := s.DB.GetGame(id)
+    if err != nil {
+        internalError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, toGameJSON(*g, s.Games.RunningGames()))
+}
+
+// getScores returns a guild's all-time scoreboard.
+func (s *Server) getScores(w http.ResponseWriter, r *http.Request) {
+    players, teams, err := s.DB.GetScores(r.PathValue("guild"))
+    if err != nil {
+        internalError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, toScoreboard(players, teams))
+}
+
+// adjustScore adds points (negative to take them away) to a player's
+// all-time score and their team's, like a correct answer outside a game.
+func (s *Server) adjustScore(w http.ResponseWriter, r *http.Request) {
+    guildID, userID := r.PathValue("guild"), r.PathValue("user")
+    var body struct {
+        Points int `json:"points"`
+    }
+    if !readJSON(w, r, &body) {
+        return
+    }
+    if body.Points == 0 {
+        writeError(w, http.StatusBadRequest, "points must be a non-zero number")
+        return
+    }
+
+    team, err := s.DB.GetPlayerTeam(guildID, userID)
+    if errors.Is(err, sql.ErrNoRows) {
+        writeError(w, http.StatusNotFound, "player has not joined a team in this guild")
+        return
+    }
+    if err != nil {
+        internalError(w, err)
+        return
+    }
+    if err := s.DB.AddScore(guildID, 0, userID, team, body.Points); err != nil {
+        internalError(w, err)
+        return
+    }
+
+    players, _, err := s.DB.GetScores(guildID)
+    if err != nil {
+        internalError(w, err)
+        return
+    }
+    for _, p := range players {
+        if p.UserID == userID {
+            writeJSON(w, http.StatusOK, playerJSON{UserID: p.UserID, Team: p.Team, Score: p.Score})
+            return
+        }
+    }
+    writeError(w, http.StatusNotFound, "player not found")
+}
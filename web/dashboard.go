@@ -0,0 +1,98 @@
+package web
+
+import (
+    "embed"
+    "html/template"
+    "io/fs"
+    "log"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+)
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// dashboardHeader must be sent with every dashboard request that changes
+// something. Cross-site forms can't set headers, so this blocks CSRF.
+const dashboardHeader = "X-Trivia-Dashboard"
+
+func (s *Server) addDashboardRoutes() {
+    files, err := fs.Sub(dashboardFiles, "dashboard")
+    if err != nil {
+        panic(err) // The embedded directory is part of the build
+    }
+    s.mux.Handle("GET /dashboard/", http.StripPrefix("/dashboard/", http.FileServerFS(files)))
+    s.mux.HandleFunc("GET /dashboard/login", s.dashboardLoginPage)
+    s.mux.HandleFunc("POST /dashboard/login", s.dashboardLogin)
+    s.mux.HandleFunc("POST /dashboard/logout", s.dashboardLogout)
+}
+
+// LoginURL returns a one-time dashboard login link for the user. It
+// satisfies bot.Dashboard.
+func (s *Server) LoginURL(userID string) (string, time.Time, error) {
+    token, expires, err := s.sessions.newLogin(userID)
+    if err != nil {
+        return "", time.Time{}, err
+    }
+    return s.PublicURL + "/dashboard/login?token=" + url.QueryEscape(token), expires, nil
+}
+
+// loginPage asks the user to confirm before their login token is used.
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Trivia dashboard login</title></head>
+<body>
+<form method="post" action="/dashboard/login">
+<input type="hidden" name="token" value="{{.}}">
+<button type="submit">Log in to the trivia dashboard</button>
+</form>
+</body>
+</html>
+`))
+
+// dashboardLoginPage shows the login link's confirm button. Link previews
+// and scanners only GET the link, so they can't use up its token.
+func (s *Server) dashboardLoginPage(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "text/html; charset=utf-8")
+    w.Header().Set("Cache-Control", "no-store")
+    w.Header().Set("Referrer-Policy", "no-referrer")
+    if err := loginPage.Execute(w, r.URL.Query().Get("token")); err != nil {
+        log.Printf("Dashboard login page error: %v", err)
+    }
+}
+
+// dashboardLogin trades a login link's token for a session cookie.
+func (s *Server) dashboardLogin(w http.ResponseWriter, r *http.Request) {
+    r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+    sessionToken, userID, ok := s.sessions.redeem(r.PostFormValue("token"))
+    if !ok {
+        http.Error(w, "This login link is invalid, expired or already used. Run !!trivia dashboard in Discord for a new one.", http.StatusUnauthorized)
+        return
+    }
+    log.Printf("Dashboard login by user %s", userID)
+
+    http.SetCookie(w, &http.Cookie{
+        Name:     sessionCookie,
+        Value:    sessionToken,
+        Path:     "/",
+        MaxAge:   int(sessionLifetime.Seconds()),
+        HttpOnly: true,
+        Secure:   strings.HasPrefix(s.PublicURL, "https://"),
+        SameSite: http.SameSiteStrictMode,
+    })
+    http.Redirect(w, r, "/dashboard/", http.StatusSeeOther)
+}
+
+func (s *Server) dashboardLogout(w http.ResponseWriter, r *http.Request) {
+    if r.Header.Get(dashboardHeader) == "" {
+        writeError(w, http.StatusForbidden, "missing "+dashboardHeader+" header")
+        return
+    }
+    if cookie, err := r.Cookie(sessionCookie); err == nil {
+        s.sessions.end(cookie.Value)
+    }
+    http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+    w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,228 @@
+'use strict';
+
+// Question bank dashboard. Talks to the same JSON API as scripts do, logged
+// in with the session cookie set by the login link.
+
+const $ = (id) => document.getElementById(id);
+
+let questions = [];       // Questions currently shown
+const selected = new Set(); // IDs ticked for bulk tagging
+let editing = null;       // Question open in the editor, null for a new one
+
+async function api(method, path, body) {
+    const options = {method, headers: {'X-Trivia-Dashboard': '1'}, credentials: 'same-origin'};
+    if (body !== undefined) {
+        options.headers['Content-Type'] = 'application/json';
+        options.body = JSON.stringify(body);
+    }
+    const resp = await fetch(path, options);
+    if (resp.status === 401) {
+        $('app').hidden = true;
+        $('logout').hidden = true;
+        $('login').hidden = false;
+        throw new Error('Not logged in.');
+    }
+    if (resp.status === 204) {
+        return null;
+    }
+    const data = await resp.json();
+    if (!resp.ok) {
+        throw new Error(data.error || resp.statusText);
+    }
+    return data;
+}
+
+function showMessage(text, isError) {
+    const message = $('message');
+    message.textContent = text;
+    message.className = isError ? 'error' : '';
+}
+
+// lines splits a textarea into trimmed, non-empty lines.
+function lines(text) {
+    return text.split('\n').map((s) => s.trim()).filter((s) => s !== '');
+}
+
+async function loadCategories() {
+    const categories = await api('GET', '/api/categories');
+    const filter = $('filter-category');
+    const current = filter.value;
+    filter.replaceChildren(new Option('All categories', ''));
+    $('categories').replaceChildren();
+    for (const c of categories) {
+        if (c.category === '') {
+            continue;
+        }
+        filter.add(new Option(`${c.category} (${c.count})`, c.category));
+        $('categories').append(new Option(c.category));
+    }
+    filter.value = current;
+}
+
+async function loadQuestions() {
+    const params = new URLSearchParams();
+    if ($('search').value.trim() !== '') {
+        params.set('q', $('search').value.trim());
+    }
+    if ($('filter-category').value !== '') {
+        params.set('category', $('filter-category').value);
+    }
+    if ($('filter-difficulty').value !== '') {
+        params.set('difficulty', $('filter-difficulty').value);
+    }
+    questions = await api('GET', '/api/questions?' + params);
+    render();
+}
+
+function render() {
+    const body = $('questions');
+    body.replaceChildren();
+    for (const q of questions) {
+        const row = body.insertRow();
+        row.addEventListener('click', () => openEditor(q));
+
+        const check = document.createElement('input');
+        check.type = 'checkbox';
+        check.checked = selected.has(q.id);
+        check.addEventListener('click', (e) => e.stopPropagation());
+        check.addEventListener('change', () => {
+            check.checked ? selected.add(q.id) : selected.delete(q.id);
+            updateSelection();
+        });
+        row.insertCell().append(check);
+
+        row.insertCell().textContent = q.id;
+        const text = row.insertCell();
+        text.textContent = q.text;
+        if (q.wrong_answers && q.wrong_answers.length > 0) {
+            const choice = document.createElement('div');
+            choice.className = 'choice';
+            choice.textContent = 'Multiple choice, also: ' + q.wrong_answers.join(', ');
+            text.append(choice);
+        }
+        row.insertCell().textContent = [q.answer, ...(q.aliases || [])].join(' / ');
+        row.insertCell().textContent = q.category || '';
+        const tags = row.insertCell();
+        for (const tag of q.tags || []) {
+            const span = document.createElement('span');
+            span.className = 'tag';
+            span.textContent = tag;
+            tags.append(span);
+        }
+        row.insertCell().textContent = q.difficulty || '';
+    }
+    $('count').textContent = `${questions.length} question${questions.length === 1 ? '' : 's'} shown`;
+    updateSelection();
+}
+
+function updateSelection() {
+    $('selected').textContent = `${selected.size} selected`;
+    const shown = questions.map((q) => q.id);
+    $('select-all').checked = shown.length > 0 && shown.every((id) => selected.has(id));
+}
+
+function openEditor(q) {
+    editing = q;
+    const form = $('form');
+    form.reset();
+    $('editor-title').textContent = q ? `Edit question #${q.id}` : 'New question';
+    $('delete').hidden = !q;
+    $('editor-error').textContent = '';
+    if (q) {
+        form.text.value = q.text;
+        form.answer.value = q.answer;
+        form.wrong_answers.value = (q.wrong_answers || []).join('\n');
+        form.aliases.value = (q.aliases || []).join('\n');
+        form.exact.checked = !!q.exact;
+        form.category.value = q.category || '';
+        form.tags.value = (q.tags || []).join(', ');
+        form.difficulty.value = q.difficulty || 'medium';
+    }
+    $('editor').showModal();
+}
+
+async function save(e) {
+    e.preventDefault();
+    const form = $('form');
+    const wrong = lines(form.wrong_answers.value);
+    const question = {
+        text: form.text.value.trim(),
+        answer: form.answer.value.trim(),
+        kind: wrong.length > 0 ? 'choice' : 'text',
+        wrong_answers: wrong,
+        aliases: lines(form.aliases.value),
+        exact: form.exact.checked,
+        category: form.category.value.trim(),
+        tags: form.tags.value.split(',').map((s) => s.trim()).filter((s) => s !== ''),
+        difficulty: form.difficulty.value,
+    };
+    try {
+        const saved = editing
+            ? await api('PUT', `/api/questions/${editing.id}`, question)
+            : await api('POST', '/api/questions', question);
+        $('editor').close();
+        showMessage(`Saved question #${saved.id}.`);
+        await Promise.all([loadQuestions(), loadCategories()]);
+    } catch (err) {
+        $('editor-error').textContent = err.message;
+    }
+}
+
+async function remove() {
+    if (!editing || !confirm(`Delete question #${editing.id}? This can't be undone.`)) {
+        return;
+    }
+    try {
+        await api('DELETE', `/api/questions/${editing.id}`);
+        selected.delete(editing.id);
+        $('editor').close();
+        showMessage(`Deleted question #${editing.id}.`);
+        await Promise.all([loadQuestions(), loadCategories()]);
+    } catch (err) {
+        $('editor-error').textContent = err.message;
+    }
+}
+
+async function bulkTag(add) {
+    const tag = $('bulk-tag').value.trim();
+    if (tag === '' || selected.size === 0) {
+        showMessage('Select questions and enter a tag first.', true);
+        return;
+    }
+    const body = {ids: [...selected], add: add ? [tag] : [], remove: add ? [] : [tag]};
+    try {
+        const result = await api('POST', '/api/questions/tags', body);
+        showMessage(`${add ? 'Added' : 'Removed'} tag "${tag}" ${add ? 'to' : 'from'} ${result.updated} question${result.updated === 1 ? '' : 's'}.`);
+        await loadQuestions();
+    } catch (err) {
+        showMessage(err.message, true);
+    }
+}
+
+let searchTimer;
+$('search').addEventListener('input', () => {
+    clearTimeout(searchTimer);
+    searchTimer = setTimeout(() => loadQuestions().catch((err) => showMessage(err.message, true)), 250);
+});
+$('filter-category').addEventListener('change', () => loadQuestions().catch((err) => showMessage(err.message, true)));
+$('filter-difficulty').addEventListener('change', () => loadQuestions().catch((err) => showMessage(err.message, true)));
+$('select-all').addEventListener('change', () => {
+    for (const q of questions) {
+        $('select-all').checked ? selected.add(q.id) : selected.delete(q.id);
+    }
+    render();
+});
+$('new').addEventListener('click', () => openEditor(null));
+$('cancel').addEventListener('click', () => $('editor').close());
+$('delete').addEventListener('click', remove);
+$('form').addEventListener('submit', save);
+$('bulk-add').addEventListener('click', () => bulkTag(true));
+$('bulk-remove').addEventListener('click', () => bulkTag(false));
+$('logout').addEventListener('click', async () => {
+    await api('POST', '/dashboard/logout').catch(() => {});
+    location.reload();
+});
+
+Promise.all([loadCategories(), loadQuestions()])
+    .then(() => { $('app').hidden = false; })
+    .catch((err) => showMessage(err.message, true));
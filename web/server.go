@@ -0,0 +1,212 @@
+// Package web serves the HTTP admin API for managing the question bank,
+// games and scores without going through Discord, and the question bank
+// dashboard built on it.
+package web
+
+import (
+    "context"
+    "crypto/rand"
+    "crypto/sha256"
+    "database/sql"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/airylvat/trivia-bot/db"
+)
+
+// maxBodySize limits request bodies, which hold one question or a small change.
+const maxBodySize = 1 << 20
+
+// tokenPrefix marks API tokens so they are easy to recognize in config and logs.
+const tokenPrefix = "tb_"
+
+// Games is what the API needs from the running bot to control games.
+type Games interface {
+    RunningGames() []int
+    EndGame(gameID int) error
+}
+
+// Server is the HTTP API and the dashboard built on it. It uses the same
+// store as the chat commands.
+type Server struct {
+    DB        db.Store
+    Games     Games
+    PublicURL string // Base of dashboard login links
+    mux       *http.ServeMux
+    sessions  *sessions
+    http      *http.Server
+}
+
+func NewServer(store db.Store, games Games, publicURL string) *Server {
+    s := &Server{
+        DB:        store,
+        Games:     games,
+        PublicURL: strings.TrimSuffix(publicURL, "/"),
+        mux:       http.NewServeMux(),
+        sessions:  newSessions(),
+    }
+
+    s.mux.HandleFunc("GET /api/questions", s.dashboardAuthed(s.listQuestions))
+    s.mux.HandleFunc("POST /api/questions", s.dashboardAuthed(s.createQuestion))
+    s.mux.HandleFunc("POST /api/questions/tags", s.dashboardAuthed(s.tagQuestions))
+    s.mux.HandleFunc("GET /api/categories", s.dashboardAuthed(s.listCategories))
+    s.mux.HandleFunc("GET /api/questions/{id}", s.dashboardAuthed(s.getQuestion))
+    s.mux.HandleFunc("PUT /api/questions/{id}", s.dashboardAuthed(s.updateQuestion))
+    s.mux.HandleFunc("DELETE /api/questions/{id}", s.dashboardAuthed(s.deleteQuestion))
+
+    s.mux.HandleFunc("GET /api/guilds/{guild}/games", s.authed(s.listGames))
+    s.mux.HandleFunc("GET /api/games/{id}", s.authed(s.getGame))
+    s.mux.HandleFunc("POST /api/games/{id}/end", s.authed(s.endGame))
+
+    s.mux.HandleFunc("GET /api/guilds/{guild}/scores", s.authed(s.getScores))
+    s.mux.HandleFunc("POST /api/guilds/{guild}/scores/{user}", s.authed(s.adjustScore))
+
+    s.addDashboardRoutes()
+    s.http = &http.Server{
+        Handler:           s,
+        ReadHeaderTimeout: 10 * time.Second,
+        ReadTimeout:       30 * time.Second,
+        WriteTimeout:      30 * time.Second,
+    }
+    return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    s.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe serves the API on addr until it fails.
+func (s *Server) ListenAndServe(addr string) error {
+    s.http.Addr = addr
+    log.Printf("HTTP API listening on %s", addr)
+    return s.http.ListenAndServe()
+}
+
+// Shutdown stops accepting requests and waits for those in progress to
+// finish, or for ctx to end.
+func (s *Server) Shutdown(ctx context.Context) error {
+    return s.http.Shutdown(ctx)
+}
+
+// NewToken generates an API token and the hash to store for it. The token
+// itself is shown once and never stored.
+func NewToken() (token, hash string, err error) {
+    token, err = randomToken()
+    if err != nil {
+        return "", "", err
+    }
+    token = tokenPrefix + token
+    return token, HashToken(token), nil
+}
+
+func randomToken() (string, error) {
+    b := make([]byte, 32)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(b), nil
+}
+
+// HashToken returns the stored form of a token. Tokens are long and random,
+// so a plain SHA-256 is enough.
+func HashToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
+
+// authed rejects requests without a valid bearer token.
+func (s *Server) authed(h http.HandlerFunc) http.HandlerFunc {
+    return s.checkAuth(h, false)
+}
+
+// dashboardAuthed also accepts dashboard sessions. Sessions go to admins of
+// any one server, so they only cover the shared question bank, never games
+// or scores.
+func (s *Server) dashboardAuthed(h http.HandlerFunc) http.HandlerFunc {
+    return s.checkAuth(h, true)
+}
+
+func (s *Server) checkAuth(h http.HandlerFunc, allowSession bool) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        who, ok := s.authenticate(w, r, allowSession)
+        if !ok {
+            return
+        }
+        if r.Method != http.MethodGet {
+            log.Printf("API %s %s by %s", r.Method, r.URL.Path, who)
+        }
+        r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+        h(w, r)
+    }
+}
+
+// authenticate checks the request's credentials and describes who sent it.
+// Dashboard sessions use a cookie instead of the Authorization header, and
+// are only accepted when allowSession is set.
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request, allowSession bool) (string, bool) {
+    header := r.Header.Get("Authorization")
+    if header == "" && allowSession {
+        if cookie, err := r.Cookie(sessionCookie); err == nil {
+            if userID, ok := s.sessions.user(cookie.Value); ok {
+                if r.Method != http.MethodGet && r.Header.Get(dashboardHeader) == "" {
+                    writeError(w, http.StatusForbidden, "missing "+dashboardHeader+" header")
+                    return "", false
+                }
+                return "dashboard user " + userID, true
+            }
+        }
+    }
+
+    token, ok := strings.CutPrefix(header, "Bearer ")
+    if !ok || strings.TrimSpace(token) == "" {
+        w.Header().Set("WWW-Authenticate", "Bearer")
+        writeError(w, http.StatusUnauthorized, "missing bearer token")
+        return "", false
+    }
+
+    t, err := s.DB.UseAPIToken(HashToken(strings.TrimSpace(token)))
+    if errors.Is(err, sql.ErrNoRows) {
+        w.Header().Set("WWW-Authenticate", "Bearer")
+        writeError(w, http.StatusUnauthorized, "invalid token")
+        return "", false
+    }
+    if err != nil {
+        internalError(w, err)
+        return "", false
+    }
+    return fmt.Sprintf("token %q", t.Name), true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    if err := json.NewEncoder(w).Encode(v); err != nil {
+        log.Printf("API response error: %v", err)
+    }
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+    writeJSON(w, status, map[string]string{"error": message})
+}
+
+func internalError(w http.ResponseWriter, err error) {
+    log.Printf("API error: %v", err)
+    writeError(w, http.StatusInternalServerError, "internal error")
+}
+
+// readJSON decodes the request body into v, rejecting unknown fields.
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+    dec := json.NewDecoder(r.Body)
+    dec.DisallowUnknownFields()
+    if err := dec.Decode(v); err != nil {
+        writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+        return false
+    }
+    return true
+}
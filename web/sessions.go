@@ -0,0 +1,97 @@
+package web
+
+import (
+    "sync"
+    "time"
+)
+
+const (
+    loginLifetime   = 10 * time.Minute // How long a dashboard login link works
+    sessionLifetime = 12 * time.Hour
+    sessionCookie   = "trivia_session"
+)
+
+type session struct {
+    userID  string
+    expires time.Time
+}
+
+// sessions holds dashboard logins in memory, keyed by token hash. They are
+// lost when the bot restarts, after which users ask for a new link.
+type sessions struct {
+    logins map[string]session // One-time login tokens not yet used
+    active map[string]session
+    mutex  sync.Mutex
+}
+
+func newSessions() *sessions {
+    return &sessions{
+        logins: make(map[string]session),
+        active: make(map[string]session),
+    }
+}
+
+// prune drops expired entries. The caller holds the lock.
+func (s *sessions) prune(now time.Time) {
+    for hash, l := range s.logins {
+        if now.After(l.expires) {
+            delete(s.logins, hash)
+        }
+    }
+    for hash, a := range s.active {
+        if now.After(a.expires) {
+            delete(s.active, hash)
+        }
+    }
+}
+
+// newLogin creates a one-time login token for the user.
+func (s *sessions) newLogin(userID string) (string, time.Time, error) {
+    token, err := randomToken()
+    if err != nil {
+        return "", time.Time{}, err
+    }
+    expires := time.Now().Add(loginLifetime)
+
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    s.prune(time.Now())
+    s.logins[HashToken(token)] = session{userID: userID, expires: expires}
+    return token, expires, nil
+}
+
+// redeem uses up a login token and starts a session for its user.
+func (s *sessions) redeem(token string) (sessionToken string, userID string, ok bool) {
+    sessionToken, err := randomToken()
+    if err != nil {
+        return "", "", false
+    }
+
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    s.prune(time.Now())
+    login, ok := s.logins[HashToken(token)]
+    if !ok {
+        return "", "", false
+    }
+    delete(s.logins, HashToken(token))
+    s.active[HashToken(sessionToken)] = session{userID: login.userID, expires: time.Now().Add(sessionLifetime)}
+    return sessionToken, login.userID, true
+}
+
+// user returns the user a session token belongs to.
+func (s *sessions) user(token string) (string, bool) {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    a, ok := s.active[HashToken(token)]
+    if !ok || time.Now().After(a.expires) {
+        return "", false
+    }
+    return a.userID, true
+}
+
+func (s *sessions) end(token string) {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    delete(s.active, HashToken(token))
+}